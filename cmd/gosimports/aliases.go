@@ -0,0 +1,237 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// An aliasMap is a flag.Value collecting the path=name pairs of -alias.
+type aliasMap map[string]string
+
+func (m aliasMap) String() string {
+	var pairs []string
+	for path, name := range m {
+		pairs = append(pairs, path+"="+name)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m aliasMap) Set(s string) error {
+	path, name, ok := strings.Cut(s, "=")
+	if !ok {
+		return fmt.Errorf("%q is not of the form path=name", s)
+	}
+	if err := imports.CheckAlias(path, name); err != nil {
+		return err
+	}
+	m[path] = name
+	return nil
+}
+
+var aliases = aliasMap{} // -alias
+
+// aliasConflicts returns the AliasConflict fixes of fixes.
+func aliasConflicts(fixes []*imports.ImportFix) []*imports.ImportFix {
+	var conflicts []*imports.ImportFix
+	for _, fix := range fixes {
+		if fix.FixType == imports.AliasConflict {
+			conflicts = append(conflicts, fix)
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].StmtInfo.ImportPath < conflicts[j].StmtInfo.ImportPath })
+	return conflicts
+}
+
+// reportAliasConflicts prints the imports of filename that could not be
+// named as the alias policy requires.
+func reportAliasConflicts(filename string, fixes []*imports.ImportFix) {
+	for _, fix := range aliasConflicts(fixes) {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filename, conflictMessage(fix))
+	}
+}
+
+// conflictMessage describes the AliasConflict fix.
+func conflictMessage(fix *imports.ImportFix) string {
+	return fmt.Sprintf("can't name the import of %q %s: the file uses %s for something else", fix.StmtInfo.ImportPath, fix.StmtInfo.Name, fix.StmtInfo.Name)
+}
+
+// aliasesMain finds the identifier most files of the module containing the
+// directory named by args, or the current directory, refer to each package
+// they import by, and reports the files referring to it by another. With -w
+// or -d, given after "aliases", it renames their imports and the references
+// to them instead, writing the files or printing the diffs.
+func aliasesMain(args []string) error {
+	fs := flag.NewFlagSet("aliases", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	write := fs.Bool("w", false, "")
+	doDiff := fs.Bool("d", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return errors.New("usage: gosimports [flags] aliases [-w | -d] [dir]")
+	}
+	args = fs.Args()
+	if *outputFormat != "text" {
+		return fmt.Errorf("aliases can't be used with -format=%s", *outputFormat)
+	}
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	if !isDir(dir) {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	root, err := findModuleRoot(dir)
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		path   string
+		src    []byte
+		opt    *imports.Options
+		idents map[string]string // by import path
+	}
+	var files []*file
+	counts := map[string]map[string]int{} // files by identifier, by import path
+	for _, job := range moduleFiles(root) {
+		if job.err != nil {
+			report(job.err)
+			continue
+		}
+		f := &file{path: job.path, idents: map[string]string{}}
+		if f.opt, err = fileOptions(job.path, multipleArg); err == nil {
+			f.src, err = os.ReadFile(job.path)
+		}
+		var uses []*imports.ImportUse
+		if err == nil {
+			uses, err = imports.ImportUses(job.path, f.src, f.opt)
+		}
+		if err != nil {
+			report(err)
+			continue
+		}
+		for _, use := range uses {
+			if counts[use.ImportPath] == nil {
+				counts[use.ImportPath] = map[string]int{}
+			}
+			counts[use.ImportPath][use.Ident]++
+			f.idents[use.ImportPath] = use.Ident
+		}
+		files = append(files, f)
+	}
+
+	majority := majorityIdents(counts)
+	for _, f := range files {
+		deviates := false
+		for path, ident := range f.idents {
+			if want, ok := majority[path]; ok && ident != want {
+				deviates = true
+				if !*write && !*doDiff {
+					total := 0
+					for _, n := range counts[path] {
+						total += n
+					}
+					fmt.Printf("%s: refers to %q as %s, not %s like %d of %d files\n", f.path, path, ident, want, counts[path][want], total)
+				}
+			}
+		}
+		if !deviates {
+			continue
+		}
+		if !*write && !*doDiff {
+			setExitCode(1)
+			continue
+		}
+		res, fixes, err := imports.RenameImports(f.path, f.src, majority, f.opt)
+		if err != nil {
+			report(err)
+			continue
+		}
+		if len(aliasConflicts(fixes)) > 0 {
+			reportAliasConflicts(f.path, fixes)
+			setExitCode(1)
+		}
+		if *doDiff {
+			os.Stdout.Write(unifiedDiff(f.src, res, f.path))
+		}
+		if *write {
+			if err := writeFile(f.path, f.src, res); err != nil {
+				report(err)
+			} else if verbose {
+				log.Printf("renamed the imports of %s", f.path)
+			}
+		}
+	}
+	return nil
+}
+
+// majorityIdents returns the identifier referring to each import path of
+// counts in more files than any other, if there is one.
+func majorityIdents(counts map[string]map[string]int) map[string]string {
+	majority := map[string]string{}
+	for path, idents := range counts {
+		best, bestCount, tie := "", 0, false
+		for ident, n := range idents {
+			switch {
+			case n > bestCount:
+				best, bestCount, tie = ident, n, false
+			case n == bestCount:
+				tie = true
+			}
+		}
+		if !tie {
+			majority[path] = best
+		}
+	}
+	return majority
+}
+
+// findModuleRoot returns the directory of the go.mod file of the module
+// containing dir, relative to the current directory if dir is relative.
+func findModuleRoot(dir string) (string, error) {
+	for d := dir; ; {
+		if isFile(filepath.Join(d, "go.mod")) {
+			return d, nil
+		}
+		abs, err := filepath.Abs(d)
+		if err != nil {
+			return "", err
+		}
+		if filepath.Dir(abs) == abs {
+			return "", fmt.Errorf("%s is not in a module", dir)
+		}
+		d = filepath.Join(d, "..")
+	}
+}
+
+// moduleFiles returns the Go files of the module whose root directory is
+// root, skipping the files walkDir skips and those of nested modules.
+func moduleFiles(root string) []fileJob {
+	var jobs []fileJob
+	var nested []string
+	walkTree(root, func(path string, f os.FileInfo, err error) {
+		switch {
+		case err != nil:
+			jobs = append(jobs, fileJob{path: path, err: err})
+		case f.IsDir() && path != root && isFile(filepath.Join(path, "go.mod")):
+			nested = append(nested, path+string(filepath.Separator))
+		case isGoFile(f):
+			for _, n := range nested {
+				if strings.HasPrefix(path, n) {
+					return
+				}
+			}
+			jobs = append(jobs, fileJob{path: path, argType: multipleArg})
+		}
+	})
+	return jobs
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rinchsan/gosimports/internal/diff"
+)
+
+// applyMain applies the diffs printed by gosimports -d, read from the file
+// named by args, or standard input if it is "-", to the files they name.
+// Either every file is patched, or none is.
+func applyMain(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: gosimports [flags] apply patchfile")
+	}
+	var patch []byte
+	var err error
+	if args[0] == "-" {
+		patch, err = io.ReadAll(os.Stdin)
+	} else {
+		patch, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return err
+	}
+	diffs, err := diff.Parse(patch)
+	if err != nil {
+		return fmt.Errorf("%s: %v", args[0], err)
+	}
+
+	// Check every file before changing any.
+	type patched struct {
+		filename string
+		fi       os.FileInfo
+		src, res []byte
+	}
+	var files []patched
+	seen := map[string]bool{}
+	var errs []string
+	for _, d := range diffs {
+		filename, err := patchTarget(d)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if seen[filename] {
+			errs = append(errs, fmt.Sprintf("%s: patched more than once", filename))
+			continue
+		}
+		seen[filename] = true
+		fi, err := os.Stat(filename)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		res, err := d.Apply(src)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", filename, err))
+			continue
+		}
+		files = append(files, patched{filename, fi, src, res})
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("not applying %s:\n\t%s", args[0], strings.Join(errs, "\n\t"))
+	}
+
+	for i, f := range files {
+		if err := writeFile(f.filename, f.src, f.res); err != nil {
+			// Put back the files already patched, keeping the backups
+			// of their originals.
+			for _, done := range files[:i] {
+				if err := replaceFile(done.filename, done.src, done.fi); err != nil {
+					report(err)
+				}
+			}
+			return err
+		}
+		if verbose {
+			log.Printf("patched %s", f.filename)
+		}
+	}
+	return nil
+}
+
+// patchTarget returns the file patched by d: the new file, without the b/
+// prefix of git-style diffs. Like git apply, it refuses absolute paths,
+// paths outside the current directory and paths going through a symbolic
+// link, so that a patch can't write anywhere else.
+func patchTarget(d *diff.FileDiff) (string, error) {
+	name := d.NewName
+	if strings.HasPrefix(d.OldName, "a/") && strings.HasPrefix(name, "b/") {
+		name = name[len("b/"):]
+	}
+	filename := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(filename) || strings.HasPrefix(name, "/") || filepath.VolumeName(filename) != "" {
+		return "", fmt.Errorf("%s: absolute path not allowed", name)
+	}
+	if filename == ".." || strings.HasPrefix(filename, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: path outside the current directory not allowed", name)
+	}
+	parts := strings.Split(filename, string(filepath.Separator))
+	for i := range parts {
+		fi, err := os.Lstat(filepath.Join(parts[:i+1]...))
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			continue
+		}
+		if i < len(parts)-1 {
+			return "", fmt.Errorf("%s: beyond a symbolic link", name)
+		}
+		return "", fmt.Errorf("%s: symbolic link not allowed", name)
+	}
+	return filename, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rinchsan/gosimports/internal/diff"
+)
+
+func TestPatchTarget(t *testing.T) {
+	for _, tt := range []struct {
+		oldName, newName string
+		want             string // empty if refused
+	}{
+		{"a.go.orig", "a.go", "a.go"},
+		{"a/sub/a.go", "b/sub/a.go", filepath.Join("sub", "a.go")},
+		{"./a.go.orig", "./a.go", "a.go"},
+		{"sub/../a.go.orig", "sub/../a.go", "a.go"},
+		{"/etc/passwd.orig", "/etc/passwd", ""},
+		{"a//etc/passwd", "b//etc/passwd", ""},
+		{"../a.go.orig", "../a.go", ""},
+		{"a/../a.go", "b/../a.go", ""},
+		{"sub/../../a.go.orig", "sub/../../a.go", ""},
+		{"...orig", "..", ""},
+	} {
+		got, err := patchTarget(&diff.FileDiff{OldName: tt.oldName, NewName: tt.newName})
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("patchTarget(%s) = %s, want an error", tt.newName, got)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("patchTarget(%s) = %s, %v, want %s", tt.newName, got, err, tt.want)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	setFlag(t, gitDiff, true)
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	writeFiles(t, root, map[string]string{
+		"outside.go": "package p\n\nimport \"os\"\n",
+		"work/a.go":  "package p\n\nimport \"os\"\n",
+	})
+	chdir(t, work)
+
+	fixed := []byte("package p\n")
+	patch := string(unifiedDiff([]byte("package p\n\nimport \"os\"\n"), fixed, "a.go"))
+	escaping := string(unifiedDiff([]byte("package p\n\nimport \"os\"\n"), fixed, "../outside.go"))
+	absolute := string(unifiedDiff([]byte("package p\n\nimport \"os\"\n"), fixed, filepath.Join(root, "outside.go")))
+	for _, bad := range []string{escaping, absolute} {
+		if err := os.WriteFile("imports.patch", []byte(patch+bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := applyMain([]string{"imports.patch"})
+		if err == nil || !strings.Contains(err.Error(), "not allowed") {
+			t.Errorf("applyMain = %v, want the path refused", err)
+		}
+		for _, name := range []string{"a.go", filepath.Join("..", "outside.go")} {
+			if got, err := os.ReadFile(name); err != nil {
+				t.Fatal(err)
+			} else if string(got) == string(fixed) {
+				t.Errorf("%s patched", name)
+			}
+		}
+	}
+
+	if err := os.WriteFile("imports.patch", []byte(patch), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyMain([]string{"imports.patch"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile("a.go"); err != nil {
+		t.Fatal(err)
+	} else if string(got) != string(fixed) {
+		t.Errorf("a.go = %q, want %q", got, fixed)
+	}
+}
+
+func TestApplySymlink(t *testing.T) {
+	setFlag(t, gitDiff, true)
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	const src = "package p\n\nimport \"os\"\n"
+	writeFiles(t, root, map[string]string{
+		"outside/a.go": src,
+		"work/a.go":    src,
+	})
+	chdir(t, work)
+	if err := os.Symlink(filepath.Join(root, "outside"), "link"); err != nil {
+		t.Skip(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "outside", "a.go"), "b.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	fixed := []byte("package p\n")
+	patch := string(unifiedDiff([]byte(src), fixed, "a.go"))
+	for _, tt := range []struct{ name, want string }{
+		{filepath.Join("link", "a.go"), "beyond a symbolic link"},
+		{"b.go", "symbolic link not allowed"},
+	} {
+		bad := string(unifiedDiff([]byte(src), fixed, tt.name))
+		if err := os.WriteFile("imports.patch", []byte(patch+bad), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := applyMain([]string{"imports.patch"})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("applyMain with %s = %v, want %q", tt.name, err, tt.want)
+		}
+		for _, name := range []string{"a.go", filepath.Join(root, "outside", "a.go")} {
+			if got, err := os.ReadFile(name); err != nil {
+				t.Fatal(err)
+			} else if string(got) != src {
+				t.Errorf("%s patched", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"path/filepath"
+
+	"golang.org/x/tools/txtar"
+)
+
+// archiveOverlay holds the contents of the files of the archive read from
+// standard input with -stdin-format=txtar, by absolute path, so that each
+// is processed along with the others rather than the files on disk.
+var archiveOverlay map[string][]byte
+
+// processArchive processes the files of the txtar archive read from in, as
+// if they were in the current directory, or -srcdir. Unless another output
+// is asked for, it writes an archive of the results to out.
+func processArchive(in io.Reader, out io.Writer) error {
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	ar := txtar.Parse(data)
+
+	dir := "."
+	if *srcdir != "" {
+		dir = *srcdir
+	}
+	archiveOverlay = map[string][]byte{}
+	for _, f := range ar.Files {
+		abs, err := filepath.Abs(filepath.Join(dir, f.Name))
+		if err != nil {
+			return err
+		}
+		archiveOverlay[abs] = f.Data
+	}
+
+	// Print the results as an archive rather than one after the other.
+	asArchive := !*list && !*doDiff && !*check && !*explain && *outputFormat == "text"
+	results := &txtar.Archive{Comment: ar.Comment}
+	for _, f := range ar.Files {
+		var buf bytes.Buffer
+		if err := processFile(f.Name, bytes.NewReader(f.Data), &buf, fromArchive, nil); err != nil {
+			report(err)
+			if asArchive {
+				// Keep the file as it was rather than dropping it.
+				buf.Reset()
+				buf.Write(f.Data)
+			}
+		}
+		if asArchive {
+			results.Files = append(results.Files, txtar.File{Name: f.Name, Data: buf.Bytes()})
+		} else if _, err := out.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	if asArchive {
+		_, err = out.Write(txtar.Format(results))
+	}
+	return err
+}
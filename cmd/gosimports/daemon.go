@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/rinchsan/gosimports/internal/daemon"
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// useDaemon is set when a daemon was found listening on -socket at startup,
+// and cleared if it stops answering.
+var (
+	useDaemon   bool
+	useDaemonMu sync.Mutex
+)
+
+// daemonMain runs a daemon processing files for other invocations of
+// gosimports until it is interrupted.
+func daemonMain(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: gosimports [flags] daemon")
+	}
+	if *socket == "" {
+		return errors.New("-socket must be set")
+	}
+	if daemon.Ping(*socket) {
+		return fmt.Errorf("a daemon is already listening on %s", *socket)
+	}
+	l, err := daemon.Listen(*socket)
+	if err != nil {
+		return err
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		l.Close() // also removes the socket
+	}()
+
+	if verbose {
+		log.Printf("listening on %s", *socket)
+	}
+	s := &daemon.Server{
+		GocmdRunner: options.Env.GocmdRunner,
+		Logf:        options.Env.Logf,
+	}
+	return s.Serve(l)
+}
+
+// processFixes is imports.ProcessFixes, forwarded to the daemon if one is
+// running.
+func processFixes(filename string, src []byte, opt *imports.Options) ([]byte, []*imports.ImportFix, error) {
+	useDaemonMu.Lock()
+	forward := useDaemon
+	useDaemonMu.Unlock()
+	if !forward {
+		return imports.ProcessFixes(filename, src, opt)
+	}
+
+	resp, err := forwardToDaemon(filename, src, opt)
+	if err != nil {
+		if verbose {
+			log.Printf("processing %s locally: %v", filename, err)
+		}
+		useDaemonMu.Lock()
+		useDaemon = false
+		useDaemonMu.Unlock()
+		return imports.ProcessFixes(filename, src, opt)
+	}
+	return resp.Result, resp.Fixes, resp.Err()
+}
+
+// forwardToDaemon asks the daemon to process the file filename.
+func forwardToDaemon(filename string, src []byte, opt *imports.Options) (*daemon.Response, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := daemon.Process(*socket, &daemon.Request{
+		Dir:      wd,
+		Env:      daemon.GoEnv(os.Environ()),
+		Filename: abs,
+		Src:      src,
+		Options:  daemon.NewOptions(opt),
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Report syntax errors as if the file had been processed here.
+	for _, e := range resp.ErrorList {
+		if e.Pos.Filename == abs {
+			e.Pos.Filename = filename
+		}
+	}
+	return resp, nil
+}
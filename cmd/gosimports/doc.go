@@ -30,6 +30,189 @@ For vim, set "gofmt_command" to "gosimports":
 
 For other editors, you probably know what to do.
 
+Editors and code generators with several unsaved files of a package can
+pipe them to gosimports together as a txtar archive with
+-stdin-format=txtar. The files are named relative to the current
+directory, or -srcdir, and each sees the others rather than the files on
+disk when fixing its imports. The results are printed as an archive too.
+
+	$ gosimports -stdin-format=txtar < files.txtar
+
+Editors speaking the Language Server Protocol can instead run
+"gosimports lsp", which serves document formatting, the "organize imports"
+code action and the completion of packages not imported yet over standard
+input and output. Unlike running gosimports on every save, the server
+remembers the packages it found in the workspace between requests. Flags
+given before "lsp" apply to every file formatted.
+
+	$ gosimports -local github.com/ourorg lsp
+
+Editors running gosimports on every save can start "gosimports daemon"
+instead, which listens on the Unix socket named by -socket. While it
+runs, gosimports forwards the files it processes to it, and so doesn't
+have to ask the go command about the module and scan the module cache
+again every time. The daemon notices changes to go.mod and go.work
+files. Use -socket= to never forward files. The socket is in
+$XDG_RUNTIME_DIR by default, or in a directory of the temporary directory
+private to the user, and files are only forwarded to sockets of the user
+that other users can't access.
+
+	$ gosimports daemon &
+	$ gosimports -w main.go
+
+Otherwise, -watch keeps gosimports running, fixing the Go files below the
+directories given as soon as they are saved and reporting what it changed.
+It skips the same files as when walking directories.
+
+	$ gosimports -watch ./cmd ./internal
+	cmd/app/main.go: add "fmt", remove "os"
+
+Settings shared by every editor, hook and CI job of a project can be put
+in a .gosimports.toml file. gosimports reads the files found in the
+directory of each processed file and its parents, with nested files
+overriding their parents, unless one is named explicitly with -config.
+Flags given on the command line take precedence over them.
+
+	# Put imports with these prefixes into a group after 3rd-party packages.
+	local = ["github.com/ourorg"]
+
+	# Separate imports into these groups, in this order.
+	groups = ["std", "prefix:golang.org/x/", "default", "prefix:github.com/ourorg/", "local"]
+
+	# Skip these files and directories when walking directories.
+	exclude = ["gen/", "*.pb.go"]
+
+	# Don't look for configuration files in parent directories.
+	root = true
+
+	# Name the imports of these packages so.
+	[aliases]
+	"k8s.io/api/core/v1" = "corev1"
+
+The prefix "auto" in -local, or the local setting, stands for the paths of
+the main modules: the module of the current directory, or every module
+used by its go.work file, so that the imports of the current modules are
+put in the last group without naming them.
+
+	$ gosimports -local auto -w .
+
+By default, imports are separated into groups for the standard library,
+third-party packages, App Engine packages and the packages of -local, in
+that order, -local taking precedence over App Engine. -groups, or the groups setting, replaces this layout with an
+ordered list of groups, each made of matchers separated by spaces: std for
+the standard library, local for the prefixes of -local, prefix:P, glob:G
+matching leading path elements, regexp:R, and default, which must appear
+once, for the imports matched by no other group. An import matched by
+several groups goes to the most specific: the longest prefix, then the
+first glob or regexp, then std.
+
+	$ gosimports -local github.com/ourorg/repo -groups 'std,prefix:golang.org/x/,default,prefix:github.com/ourorg/,local' -w .
+
+The matchers blank and dot place the imports named _ and . in a group,
+whatever their path. -blank-dot-groups, or blank_dot_groups = true, adds
+such groups after the others, making side-effect imports stand out.
+
+-alias path=name, or the [aliases] table, makes the imports of path use
+name, renaming the references to them, and adds the import when the file
+refers to name without importing it. When the file uses the name for
+something else, the import is left as it is and the conflict is reported,
+and with -check, the exit status is 1. -remove-redundant-aliases, or
+remove_redundant_aliases = true, removes the names of imports that are
+the names of their packages already, like errors "errors".
+
+	$ gosimports -alias k8s.io/api/core/v1=corev1 -alias k8s.io/apimachinery/pkg/apis/meta/v1=metav1 -w .
+
+Rather than naming the aliases, "gosimports aliases" finds the identifier
+most files of the module of the current directory, or of the directory
+given, refer to each imported package by, and reports the files using
+another one. With -w after "aliases", it renames their imports and the
+references to them instead, and with -d, prints the diffs. Packages
+referred to by several identifiers in as many files are left alone. With
+-generated=format-only or -generated=skip, generated files are neither
+counted nor renamed.
+
+	$ gosimports aliases
+	internal/store/pods.go: refers to "k8s.io/api/core/v1" as v1, not corev1 like 12 of 14 files
+	$ gosimports aliases -w
+
+When packages move, or a dependency gets a new major version,
+-rewrite 'old=>new' changes the imports of old, and of the packages below
+it, to import new and the packages below it instead, then sorts and
+groups them again. The imports of packages with another name than before
+are named after the old one, so that the code referring to them still
+compiles. Only the files importing old are changed, and the imports are
+not fixed otherwise; generated files are left unchanged too, unless
+-generated=full, the default. The flag may be repeated; the longest old
+path matching an import applies. When new is below old, imports of new
+or below it are left alone, so that running it again changes nothing.
+
+	$ gosimports -rewrite 'github.com/ourorg/lib=>github.com/ourorg/lib/v2' -w .
+
+An import of "C" is never grouped with other imports. When it appears in
+a block with them, gosimports moves it, with the cgo preamble commented
+right above it, to a declaration of its own following the block.
+
+When walking directories, gosimports skips vendor and testdata
+directories and the files ignored by .gitignore files. More files can be
+skipped with -exclude, and -include restricts the files processed to those
+matching it. Both flags take gitignore-style globs relative to the
+directory walked and may be repeated. Directories and files named on the
+command line are always processed.
+
+	$ gosimports -l -exclude 'internal/gen/' -include '*_test.go' .
+
+Generated files, marked by a "// Code generated ... DO NOT EDIT." comment
+before the package clause, are processed like any other file by default.
+Use -generated=format-only to leave their imports alone, or
+-generated=skip to leave them unchanged.
+
+When gosimports picks an unexpected package, -explain prints, for each
+file, why imports are added, removed or renamed, and for each unresolved
+identifier, the candidate packages that were considered, with the one
+chosen and the reason each of the others was rejected.
+
+To only fix the files touched by a branch, use -changed-since with a git
+revision; the Go files added or modified since then, including untracked
+ones, are processed. In a pre-commit hook, -staged processes the contents
+of the files staged for commit rather than the working tree files, so
+that partially staged files are handled correctly:
+
+	$ gosimports -changed-since origin/main -w
+	$ gosimports -staged -w
+
+With -w, files are replaced by renaming a temporary file over them, so
+that they are never left half written, keeping their permissions and
+owner; the targets of symbolic links are replaced rather than the links.
+Files with several hard links, or whose owner can't be kept, are
+overwritten in place instead, which -v reports.
+A file modified by something else while gosimports processed it is left
+alone. -backup keeps the previous version of each file changed:
+
+	$ gosimports -w -backup .orig .
+
+The diffs printed by -d can be applied later, such as in another CI job,
+with "gosimports apply". Every file must still have the contents the diff
+was made from, or no file is changed. Like git apply, it refuses to patch
+files named by absolute paths or outside the current directory.
+
+	$ gosimports -d . > imports.patch
+	$ gosimports apply imports.patch
+
+When gosimports is slow or doesn't find a package, "gosimports doctor"
+describes how imports are resolved in a directory: the go env, whether
+modules or GOPATH are used and why, the main modules, how long scanning
+each directory tree for packages takes and how many packages were found,
+and the errors of the go command. Use -format=json for a JSON object.
+
+	$ gosimports doctor ./cmd/app
+
+A subcommand is only run when no file or directory has its name and none
+of -l, -w, -d, -check, -explain, -watch, -changed-since, -staged and
+-rewrite is given; otherwise, its name is taken for a path to process.
+Put -- before the name to run the subcommand regardless.
+
+	$ gosimports -- lsp
+
 To exclude directories in your $GOPATH from being scanned for Go
 files, gosimports respects a configuration file at
 $GOPATH/src/.goimportsignore which may contain blank lines, comment
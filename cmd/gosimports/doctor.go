@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rinchsan/gosimports/internal/daemon"
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// doctorMain describes how imports are resolved for the files of the
+// directory named by args, or the current directory: the go env, the
+// resolver chosen, the modules and directories scanned for packages and how
+// long each took, and the errors met on the way.
+func doctorMain(args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: gosimports [flags] doctor [dir]")
+	}
+	dir := "."
+	if len(args) == 1 {
+		dir = args[0]
+	}
+	if !isDir(dir) {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	// Use a new environment, so that the scans aren't shortened by
+	// anything already cached.
+	env := &imports.ProcessEnv{
+		GocmdRunner: options.Env.GocmdRunner,
+		Logf:        options.Env.Logf,
+		WorkingDir:  dir,
+	}
+	d := imports.Diagnose(env)
+
+	switch *outputFormat {
+	case "text":
+		printDiagnosis(os.Stdout, d)
+	case "json":
+		b, err := json.MarshalIndent(d, "", "\t")
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(append(b, '\n'))
+	default:
+		return fmt.Errorf("doctor can't be used with -format=%s", *outputFormat)
+	}
+	if len(d.Errors) > 0 {
+		setExitCode(2)
+	}
+	return nil
+}
+
+// printDiagnosis prints d in sections for humans to read.
+func printDiagnosis(w io.Writer, d *imports.Diagnosis) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	section := func(title string) { fmt.Fprintf(tw, "\n%s:\n", title) }
+
+	fmt.Fprintf(tw, "working directory: %s\n", d.WorkingDir)
+	if *socket != "" {
+		running := "not running"
+		if daemon.Ping(*socket) {
+			running = "running"
+		}
+		fmt.Fprintf(tw, "daemon: %s on %s\n", running, *socket)
+	}
+
+	if len(d.Env) > 0 {
+		section("go env")
+		var keys []string
+		for k := range d.Env {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(tw, "\t%s=%s\n", k, d.Env[k])
+		}
+	}
+
+	if d.Resolver != "" {
+		section("resolver")
+		fmt.Fprintf(tw, "\t%s, as %s\n", d.Resolver, d.ResolverReason)
+		if d.Vendor {
+			fmt.Fprintf(tw, "\tpackages of dependencies are found in the vendor directory\n")
+		}
+	}
+
+	if len(d.MainModules) > 0 {
+		section("main modules")
+		for _, m := range d.MainModules {
+			fmt.Fprintf(tw, "\t%s\t%s\n", m.Path, m.Dir)
+		}
+	}
+	if d.ModuleCacheDir != "" {
+		section("module cache")
+		fmt.Fprintf(tw, "\t%s\n", d.ModuleCacheDir)
+	}
+
+	if len(d.Roots) > 0 {
+		section("roots scanned")
+		var total time.Duration
+		for _, root := range d.Roots {
+			fmt.Fprintf(tw, "\t%s\t%s\t%d dirs\t%v\n", root.Path, root.Type, root.Dirs, root.Duration.Round(time.Millisecond))
+			total += root.Duration
+		}
+		fmt.Fprintf(tw, "\ttotal\t\t\t%v\n", total.Round(time.Millisecond))
+
+		section("cached directories")
+		if d.Resolver == "module" {
+			fmt.Fprintf(tw, "\tmodule cache\t%d\n", d.ModuleCacheDirs)
+		}
+		fmt.Fprintf(tw, "\tother\t%d\n", d.OtherDirs)
+	}
+
+	if len(d.Errors) > 0 {
+		section("errors")
+		for _, err := range d.Errors {
+			fmt.Fprintf(tw, "\t%s\n", strings.ReplaceAll(strings.TrimSpace(err), "\n", "\n\t"))
+		}
+	}
+}
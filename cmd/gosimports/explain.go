@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// writeExplanation writes to out the explanation of the fixes to the
+// imports of src, read from filename and processed as the file target.
+func writeExplanation(out io.Writer, filename, target string, src []byte, argType argumentType) error {
+	opt, err := fileOptions(target, argType)
+	if err != nil {
+		return err
+	}
+	ex, err := imports.Explain(target, src, opt)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s:\n", filename)
+	if ex.Skipped != "" {
+		fmt.Fprintf(&b, "\t%s\n", ex.Skipped)
+	} else if len(ex.Fixes) == 0 && len(ex.Refs) == 0 {
+		fmt.Fprintf(&b, "\timports are correct\n")
+	}
+	for _, f := range ex.Fixes {
+		fmt.Fprintf(&b, "\t%s: %s\n", describeFix(f.Fix), f.Reason)
+	}
+	for _, ref := range ex.Refs {
+		chosen := "no package found"
+		if ref.Chosen != "" {
+			chosen = "chose " + strconv.Quote(ref.Chosen)
+		}
+		fmt.Fprintf(&b, "\t%s.{%s}: %s\n", ref.Name, strings.Join(ref.Symbols, ","), chosen)
+		for _, c := range ref.Candidates {
+			mark := "-"
+			if c.Rejected == "" && c.ImportPath == ref.Chosen {
+				mark = "*"
+			}
+			details := []string{string(c.Source)}
+			if c.Dir != "" {
+				details = append(details, "in "+c.Dir)
+			}
+			if c.Distance >= 0 {
+				details = append(details, fmt.Sprintf("distance %d", c.Distance))
+			}
+			if c.Relevance > 0 {
+				details = append(details, fmt.Sprintf("relevance %g", c.Relevance))
+			}
+			if c.OutOfScope {
+				details = append(details, "not in go.mod")
+			}
+			fmt.Fprintf(&b, "\t\t%s %q (%s)", mark, c.ImportPath, strings.Join(details, ", "))
+			if c.Rejected != "" {
+				fmt.Fprintf(&b, ": %s", c.Rejected)
+			}
+			b.WriteString("\n")
+		}
+	}
+	_, err = io.WriteString(out, b.String())
+	return err
+}
+
+// describeFix describes fix as the verb of its type and the import spec it
+// adds, removes or renames, such as `add "fmt"`.
+func describeFix(fix *imports.ImportFix) string {
+	verb := [...]string{"add", "remove", "rename", "can't rename"}[fix.FixType]
+	spec := strconv.Quote(fix.StmtInfo.ImportPath)
+	if name := fix.StmtInfo.Name; name != "" {
+		spec = name + " " + spec
+	}
+	return verb + " " + spec
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	exec "golang.org/x/sys/execabs"
+)
+
+// git runs git in dir with args, feeding it stdin if non-nil, and returns
+// its standard output.
+func git(dir string, stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("git %s: %v", args[0], err)
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitTopLevel returns the root directory of the working tree containing the
+// current directory.
+func gitTopLevel() (string, error) {
+	out, err := git("", nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+	return filepath.FromSlash(strings.TrimSpace(string(out))), nil
+}
+
+// splitNUL splits the NUL-terminated records printed by git's -z option.
+func splitNUL(out []byte) []string {
+	var recs []string
+	for _, rec := range bytes.Split(out, []byte{0}) {
+		if len(rec) > 0 {
+			recs = append(recs, string(rec))
+		}
+	}
+	return recs
+}
+
+// gitPathspecs returns the pathspecs selecting the files below paths, or the
+// whole working tree if there are none.
+func gitPathspecs(paths []string) []string {
+	if len(paths) == 0 {
+		return []string{":/"}
+	}
+	return paths
+}
+
+// changedFiles returns the jobs for the Go files below paths that were added
+// or modified in the working tree since the revision rev, including
+// untracked files that aren't ignored.
+func changedFiles(rev string, paths []string) ([]fileJob, error) {
+	top, err := gitTopLevel()
+	if err != nil {
+		return nil, err
+	}
+	specs := gitPathspecs(paths)
+	// --end-of-options keeps a revision beginning with a dash from being
+	// taken for an option.
+	changed, err := git("", nil, append([]string{"diff", "--name-only", "-z", "--no-renames", "--diff-filter=AM", "--end-of-options", rev, "--"}, specs...)...)
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git("", nil, append([]string{"ls-files", "-z", "--others", "--exclude-standard", "--full-name", "--"}, specs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	for _, name := range append(splitNUL(changed), splitNUL(untracked)...) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var jobs []fileJob
+	for _, name := range names {
+		path := displayPath(top, name)
+		if ok, err := gitJobWanted(top, path); err != nil {
+			jobs = append(jobs, fileJob{path: path, err: err})
+		} else if ok {
+			jobs = append(jobs, fileJob{path: path, argType: multipleArg})
+		}
+	}
+	return jobs, nil
+}
+
+// An indexEntry is a file staged in the git index.
+type indexEntry struct {
+	top    string // root of the working tree
+	name   string // slash-separated path relative to top
+	mode   string
+	object string // hash of the staged blob
+}
+
+// stagedFiles returns the jobs for the Go files below paths whose staged
+// contents differ from HEAD, to be read from and written to the index.
+func stagedFiles(paths []string) ([]fileJob, error) {
+	top, err := gitTopLevel()
+	if err != nil {
+		return nil, err
+	}
+	specs := gitPathspecs(paths)
+	out, err := git("", nil, append([]string{"diff", "--cached", "--name-only", "-z", "--no-renames", "--diff-filter=AM", "--"}, specs...)...)
+	if err != nil {
+		return nil, err
+	}
+	names := splitNUL(out)
+	if len(names) == 0 {
+		return nil, nil
+	}
+	out, err = git("", nil, append([]string{"ls-files", "-z", "--stage", "--full-name", "--"}, specs...)...)
+	if err != nil {
+		return nil, err
+	}
+	entries := map[string]*indexEntry{}
+	for _, rec := range splitNUL(out) {
+		// <mode> SP <object> SP <stage> TAB <file>
+		info, name, ok := strings.Cut(rec, "\t")
+		fields := strings.Fields(info)
+		if !ok || len(fields) != 3 {
+			return nil, fmt.Errorf("git ls-files: unexpected output %q", rec)
+		}
+		if fields[2] == "0" {
+			entries[name] = &indexEntry{top: top, name: name, mode: fields[0], object: fields[1]}
+		}
+	}
+
+	sort.Strings(names)
+	var jobs []fileJob
+	for _, name := range names {
+		path := displayPath(top, name)
+		e := entries[name]
+		switch ok, err := gitJobWanted(top, path); {
+		case err != nil:
+			jobs = append(jobs, fileJob{path: path, err: err})
+		case !ok:
+		case e == nil:
+			jobs = append(jobs, fileJob{path: path, err: fmt.Errorf("%s: not found in the index", path)})
+		case e.mode != "100644" && e.mode != "100755":
+			// Symbolic links and submodules have no source to fix.
+		default:
+			jobs = append(jobs, fileJob{path: path, argType: multipleArg, staged: e})
+		}
+	}
+	return jobs, nil
+}
+
+// gitJobWanted reports whether the file at path, listed by git for the
+// working tree rooted at top, should be processed: whether it's a Go file
+// not excluded by default, by flags or by configuration files.
+func gitJobWanted(top, path string) (bool, error) {
+	base := filepath.Base(path)
+	if strings.HasPrefix(base, ".") || !strings.HasSuffix(base, ".go") {
+		return false, nil
+	}
+	if excluded, err := flagExcluded(top, path, false); excluded || err != nil {
+		return false, err
+	}
+	excluded, err := isExcluded(path, false)
+	return !excluded, err
+}
+
+// displayPath returns the path of the file named name relative to the
+// working tree root top, relative to the current directory if possible.
+func displayPath(top, name string) string {
+	abs := filepath.Join(top, filepath.FromSlash(name))
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, abs); err == nil {
+			return rel
+		}
+	}
+	return abs
+}
+
+// indexMu serializes updates of the index, which git guards with a lock
+// file that concurrent updates would fail to acquire.
+var indexMu sync.Mutex
+
+// processStaged runs processFile on the staged contents of the file at
+// filename, writing the result back to the index with -w.
+func processStaged(filename string, e *indexEntry, out io.Writer) error {
+	src, err := git(e.top, nil, "cat-file", "blob", e.object)
+	if err != nil {
+		return err
+	}
+	return processFile(filename, bytes.NewReader(src), out, multipleArg, func(res []byte) error {
+		return e.update(filename, src, res)
+	})
+}
+
+// update replaces the staged contents src of the file at filename with res.
+// The working tree file is updated too if it has no unstaged changes, so
+// that it doesn't undo the change; otherwise, it is left alone.
+func (e *indexEntry) update(filename string, src, res []byte) error {
+	out, err := git(e.top, res, "hash-object", "-w", "--no-filters", "--stdin")
+	if err != nil {
+		return err
+	}
+	object := strings.TrimSpace(string(out))
+
+	indexMu.Lock()
+	_, err = git(e.top, nil, "update-index", "--cacheinfo", e.mode+","+object+","+e.name)
+	indexMu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Leave the working tree file alone unless it has the staged contents.
+	err = writeFile(filename, src, res)
+	if errors.Is(err, errFileChanged) || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// gitRepo makes the current directory a new git repository with files
+// committed, for the duration of the test.
+func gitRepo(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	chdir(t, dir)
+	for _, kv := range [][2]string{
+		{"GIT_AUTHOR_NAME", "test"}, {"GIT_AUTHOR_EMAIL", "test@example.com"},
+		{"GIT_COMMITTER_NAME", "test"}, {"GIT_COMMITTER_EMAIL", "test@example.com"},
+		{"GIT_CONFIG_NOSYSTEM", "1"}, {"HOME", dir},
+	} {
+		t.Setenv(kv[0], kv[1])
+	}
+	writeFiles(t, dir, files)
+	runGit(t, "init", "-q")
+	runGit(t, "add", ".")
+	runGit(t, "commit", "-q", "-m", "initial")
+	return dir
+}
+
+func runGit(t *testing.T, args ...string) string {
+	out, err := git("", nil, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func jobPaths(jobs []fileJob) []string {
+	var paths []string
+	for _, job := range jobs {
+		paths = append(paths, job.path)
+	}
+	return paths
+}
+
+func TestChangedFiles(t *testing.T) {
+	gitRepo(t, map[string]string{
+		".gitignore": "ignored.go\n",
+		"a.go":       "package p\n",
+		"b.go":       "package p\n",
+		"c.txt":      "text\n",
+	})
+	writeFiles(t, ".", map[string]string{
+		"a.go":       "package p\n\nvar A int\n",
+		"c.txt":      "changed\n",
+		"new.go":     "package p\n",
+		"ignored.go": "package p\n",
+	})
+	jobs, err := changedFiles("HEAD", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := jobPaths(jobs), []string{"a.go", "new.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("changedFiles() = %q, want %q", got, want)
+	}
+}
+
+func TestChangedFilesOptionLikeRev(t *testing.T) {
+	dir := gitRepo(t, map[string]string{"a.go": "package p\n"})
+	out := filepath.Join(dir, "out")
+	if _, err := changedFiles("--output="+out, nil); err == nil {
+		t.Error("changedFiles() succeeded with an option as the revision")
+	}
+	if _, err := os.Stat(out); err == nil {
+		t.Errorf("git diff wrote %s", out)
+	}
+}
+
+func TestStagedWrite(t *testing.T) {
+	setFlag(t, write, true)
+	setFlag(t, socket, "")
+	gitRepo(t, map[string]string{"a.go": "package p\n", "b.go": "package p\n"})
+	const staged = "package p\n\nimport \"os\"\n"
+	const fixed = "package p\n"
+	writeFiles(t, ".", map[string]string{"a.go": staged, "b.go": staged})
+	runGit(t, "add", "a.go", "b.go")
+	// b.go has unstaged changes, which must be kept.
+	const unstaged = staged + "\nvar B int\n"
+	writeFiles(t, ".", map[string]string{"b.go": unstaged})
+
+	jobs, err := stagedFiles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := jobPaths(jobs), []string{"a.go", "b.go"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("stagedFiles() = %q, want %q", got, want)
+	}
+	for _, job := range jobs {
+		if err := processJob(job, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct{ name, index, tree string }{
+		{"a.go", fixed, fixed},
+		{"b.go", fixed, unstaged},
+	} {
+		if got := runGit(t, "show", ":"+tt.name); got != tt.index {
+			t.Errorf("staged %s = %q, want %q", tt.name, got, tt.index)
+		}
+		if got, err := os.ReadFile(tt.name); err != nil || string(got) != tt.tree {
+			t.Errorf("working tree %s = %q, %v, want %q", tt.name, got, err, tt.tree)
+		}
+	}
+}
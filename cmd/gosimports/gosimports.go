@@ -19,10 +19,13 @@ import (
 	"runtime/debug"
 	"runtime/pprof"
 	"strings"
+	"sync"
 
+	"github.com/rinchsan/gosimports/internal/config"
+	"github.com/rinchsan/gosimports/internal/daemon"
+	"github.com/rinchsan/gosimports/internal/diff"
 	"github.com/rinchsan/gosimports/internal/gocommand"
 	"github.com/rinchsan/gosimports/internal/imports"
-	exec "golang.org/x/sys/execabs"
 )
 
 var (
@@ -30,10 +33,34 @@ var (
 	showVersion = flag.Bool("version", false, "show version")
 
 	// main operation modes
-	list   = flag.Bool("l", false, "list files whose formatting differs from gosimport's")
-	write  = flag.Bool("w", false, "write result to (source) file instead of stdout")
-	doDiff = flag.Bool("d", false, "display diffs instead of rewriting files")
-	srcdir = flag.String("srcdir", "", "choose imports as if source code is from `dir`. When operating on a single file, dir may instead be the complete file name.")
+	list        = flag.Bool("l", false, "list files whose formatting differs from gosimport's")
+	check       = flag.Bool("check", false, "exit with status 1 if the formatting of any file differs from gosimport's, instead of printing the result")
+	write       = flag.Bool("w", false, "write result to (source) file instead of stdout")
+	backup      = flag.String("backup", "", "with -w, keep the previous version of each file changed next to it, named with the `suffix` appended, such as .orig")
+	doDiff      = flag.Bool("d", false, "display diffs instead of rewriting files")
+	watch       = flag.Bool("watch", false, "watch the directories given, or the current one, and fix the Go files in them whenever they change, reporting the changes made; implies -w")
+	explain     = flag.Bool("explain", false, "explain why imports are added, removed or renamed, and how the packages of unresolved identifiers are chosen, instead of printing the result")
+	srcdir      = flag.String("srcdir", "", "choose imports as if source code is from `dir`. When operating on a single file, dir may instead be the complete file name.")
+	configFile  = flag.String("config", "", "read configuration from `file` instead of the "+config.FileName+" files found in the directories of processed files and their parents")
+	concurrency = flag.Int("j", runtime.NumCPU(), "process up to `N` files concurrently")
+	socket      = flag.String("socket", daemon.DefaultSocket(), "listen on, or forward files to a daemon listening on, the Unix socket `path`; empty to never forward")
+
+	// file selection via git
+	changedSince = flag.String("changed-since", "", "only process the Go files added or modified since the git revision `rev`, and untracked ones; paths restrict the files to those below them")
+	staged       = flag.Bool("staged", false, "only process the staged contents of the Go files changed in the git index; with -w, write the result back to the index")
+
+	// diff output
+	diffContext = flag.Int("U", 3, "with -d, show `N` lines of context around each change")
+	gitDiff     = flag.Bool("git-diff", false, "with -d, print git-style headers with a/ and b/ path prefixes")
+	diffColor   = flag.String("color", "never", "with -d, colorize the diff: `when` is auto, always or never")
+
+	groups = flag.String("groups", "", "separate imports into these `groups`, in order: a comma-separated list of std, default, local, prefix:P, glob:G or regexp:R, with several matchers of a group separated by spaces (default \""+strings.Join(imports.DefaultGroups, ",")+"\")")
+
+	generated = flag.String("generated", "full", "how to process generated files: `policy` is full, format-only to not fix their imports, or skip to leave them unchanged")
+
+	stdinFormat = flag.String("stdin-format", "go", "read standard input as `format`: go for a single file, or txtar for an archive of files of the same package, relative to the current directory or -srcdir, and print an archive of the results")
+
+	outputFormat = flag.String("format", "text", "report results in `format`: text, json for a JSON object per file, or sarif for a SARIF 2.1.0 log, in place of the usual output")
 
 	verbose bool // verbose logging
 
@@ -50,22 +77,89 @@ var (
 			GocmdRunner: &gocommand.Runner{},
 		},
 	}
-	exitCode = 0
+	exitCode   = 0
+	exitCodeMu sync.Mutex
+
+	// explicitFlags records the flags set on the command line, which take
+	// precedence over configuration files.
+	explicitFlags = map[string]bool{}
+
+	configs        config.Finder
+	explicitConfig *config.Config // the configuration read from -config, if any
 )
 
 func init() {
 	flag.BoolVar(&options.AllErrors, "e", false, "report all errors (not just the first 10 on different lines)")
-	flag.StringVar(&options.LocalPrefix, "local", "", "put imports beginning with this string after 3rd-party packages; comma-separated list")
+	flag.StringVar(&options.LocalPrefix, "local", "", "put imports beginning with this string after 3rd-party packages; comma-separated list, in which auto stands for the main modules")
+	flag.BoolVar(&options.BlankDotGroups, "blank-dot-groups", false, "put blank imports and dot imports in groups of their own after the others")
+	flag.Var(aliases, "alias", "with `path=name`, name the imports of path so, renaming the references to them; may be repeated, and adds to the aliases of configuration files")
+	flag.BoolVar(&options.RemoveRedundantAliases, "remove-redundant-aliases", false, "remove the names of imports that are the names of their packages, like errors \"errors\"")
+	flag.Var(rewrites, "rewrite", "with `old=>new`, rewrite the import paths equal to old or beginning with old/ to begin with new instead, keeping the names the files refer to the packages by, and leave the files importing no such path unchanged; may be repeated")
 	flag.BoolVar(&options.FormatOnly, "format-only", false, "if true, don't fix imports and only format. In this mode, gosimports is effectively gofmt, with the addition that imports are grouped into sections.")
+	flag.Var(&excludes, "exclude", "when walking directories, skip the files and directories matching `glob`, relative to the directory walked; may be repeated")
+	flag.Var(&includes, "include", "when walking directories, only process the files matching `glob`, relative to the directory walked; may be repeated")
 }
 
 func report(err error) {
 	scanner.PrintError(os.Stderr, err)
-	exitCode = 2
+	setExitCode(2)
+}
+
+// setExitCode raises the exit status to code. Errors (2) take precedence
+// over files needing changes with -check (1).
+func setExitCode(code int) {
+	exitCodeMu.Lock()
+	defer exitCodeMu.Unlock()
+	if code > exitCode {
+		exitCode = code
+	}
+}
+
+// subcommands are the commands run instead of processing files when their
+// name is the first argument, unless a file or directory has that name or
+// processingFlags are given. Preceding the name with -- runs the command
+// regardless.
+var subcommands = map[string]func(args []string) error{
+	"lsp":     lspMain,
+	"daemon":  daemonMain,
+	"apply":   applyMain,
+	"doctor":  doctorMain,
+	"aliases": aliasesMain,
+}
+
+// processingFlags are the flags only meaningful when processing files. When
+// any is given, the first argument is a path even if it names a subcommand.
+var processingFlags = []string{"l", "w", "d", "check", "explain", "watch", "changed-since", "staged", "rewrite"}
+
+// subcommand returns the subcommand named by the first of args, the paths
+// given on the command line, if they name one rather than paths. afterDash
+// reports whether args followed --.
+func subcommand(args []string, afterDash bool) func(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	cmd, ok := subcommands[args[0]]
+	if !ok || afterDash {
+		return cmd
+	}
+	for _, name := range processingFlags {
+		if explicitFlags[name] {
+			return nil
+		}
+	}
+	if _, err := os.Lstat(args[0]); err == nil {
+		return nil
+	}
+	return cmd
 }
 
 func usage() {
 	fmt.Fprintf(os.Stderr, "usage: gosimports [flags] [path ...]\n")
+	fmt.Fprintf(os.Stderr, "       gosimports [flags] [--] lsp\n")
+	fmt.Fprintf(os.Stderr, "       gosimports [flags] [--] daemon\n")
+	fmt.Fprintf(os.Stderr, "       gosimports [flags] [--] apply patchfile\n")
+	fmt.Fprintf(os.Stderr, "       gosimports [flags] [--] doctor [dir]\n")
+	fmt.Fprintf(os.Stderr, "       gosimports [flags] [--] aliases [-w | -d] [dir]\n")
 	flag.PrintDefaults()
 	os.Exit(2)
 }
@@ -90,32 +184,21 @@ const (
 	// multipleArg is when the user ran "gosimports file1.go file2.go"
 	// or ran gosimports on a directory tree.
 	multipleArg
-)
-
-func processFile(filename string, in io.Reader, out io.Writer, argType argumentType) error {
-	opt := options
-	if argType == fromStdin {
-		nopt := *options
-		nopt.Fragment = true
-		opt = &nopt
-	}
-
-	if in == nil {
-		f, err := os.Open(filename)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		in = f
-	}
 
-	src, err := io.ReadAll(in)
-	if err != nil {
-		return err
-	}
+	// fromArchive is when the user is piping a txtar archive of files into
+	// gosimports, with -stdin-format=txtar.
+	fromArchive
+)
 
+// processFile processes the file filename, reading its source from in, or
+// from the file if in is nil. With -w, the result is passed to save, or
+// written to the file if save is nil.
+func processFile(filename string, in io.Reader, out io.Writer, argType argumentType, save func(res []byte) error) error {
 	target := filename
-	if *srcdir != "" {
+	if *srcdir != "" && argType == fromArchive {
+		// The files of the archive are relative to the directory.
+		target = filepath.Join(*srcdir, filename)
+	} else if *srcdir != "" {
 		// Determine whether the provided -srcdirc is a directory or file
 		// and then use it to override the target.
 		//
@@ -142,63 +225,273 @@ func processFile(filename string, in io.Reader, out io.Writer, argType argumentT
 		}
 	}
 
-	res, err := imports.Process(target, src, opt)
+	src, res, fixes, err := fixFile(filename, target, in, argType)
+	changed := err == nil && !bytes.Equal(src, res)
+	if changed && *write {
+		if argType == fromStdin || argType == fromArchive {
+			// filename is "<standard input>", or not a file
+			err = errors.New("can't use -w on stdin")
+		} else if save != nil {
+			err = save(res)
+		} else {
+			err = writeFile(filename, src, res)
+		}
+	}
+	if (changed || len(aliasConflicts(fixes)) > 0) && *check {
+		setExitCode(1)
+	}
+	switch *outputFormat {
+	case "json":
+		return writeJSONReport(out, filename, changed, fixes, err)
+	case "sarif":
+		return addSARIFResults(filename, src, res, changed, fixes, err)
+	}
 	if err != nil {
 		return err
 	}
+	reportAliasConflicts(filename, fixes)
 
-	if !bytes.Equal(src, res) {
+	if changed && *watch {
+		fmt.Fprintf(out, "%s: %s\n", filename, describeFixes(fixes))
+	}
+	if *explain {
+		if err := writeExplanation(out, filename, target, src, argType); err != nil {
+			return err
+		}
+	}
+	if changed {
 		// formatting has changed
 		if *list {
 			fmt.Fprintln(out, filename)
 		}
-		if *write {
-			if argType == fromStdin {
-				// filename is "<standard input>"
-				return errors.New("can't use -w on stdin")
-			}
-			// On Windows, we need to re-set the permissions from the file. See golang/go#38225.
-			var perms os.FileMode
-			if fi, err := os.Stat(filename); err == nil {
-				perms = fi.Mode() & os.ModePerm
-			}
-			err = os.WriteFile(filename, res, perms)
-			if err != nil {
-				return err
-			}
-		}
 		if *doDiff {
 			if argType == fromStdin {
 				filename = "stdin.go" // because <standard input>.orig looks silly
 			}
-			data, err := diff(src, res, filename)
-			if err != nil {
-				return fmt.Errorf("computing diff: %s", err)
-			}
-			fmt.Printf("diff -u %s %s\n", filepath.ToSlash(filename+".orig"), filepath.ToSlash(filename))
-			_, _ = out.Write(data)
+			_, _ = out.Write(unifiedDiff(src, res, filename))
 		}
 	}
 
-	if !*list && !*write && !*doDiff {
+	if !*list && !*write && !*doDiff && !*check && !*explain {
 		_, err = out.Write(res)
 	}
 
 	return err
 }
 
-func visitFile(path string, f os.FileInfo, err error) error {
-	if err == nil && isGoFile(f) {
-		err = processFile(path, nil, os.Stdout, multipleArg)
+// fixFile reads the source of filename from in, or from the file if in is
+// nil, and returns it along with the result of processing it as if it were
+// the file target, and the fixes applied to its imports.
+func fixFile(filename, target string, in io.Reader, argType argumentType) (src, res []byte, fixes []*imports.ImportFix, err error) {
+	opt, err := fileOptions(target, argType)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if in == nil {
+		f, err := os.Open(filename)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	src, err = io.ReadAll(in)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if len(rewrites) > 0 {
+		res, fixes, err = imports.RewriteImports(target, src, rewrites, opt)
+	} else {
+		res, fixes, err = processFixes(target, src, opt)
+	}
+	return src, res, fixes, err
+}
+
+// configFor returns the configuration applying to files in dir.
+func configFor(dir string) (*config.Config, error) {
+	if explicitConfig != nil {
+		return explicitConfig, nil
 	}
+	return configs.Find(dir)
+}
+
+// fileOptions returns the options for processing the file target: options,
+// adjusted by the configuration applying to target where no flag overrides it.
+func fileOptions(target string, argType argumentType) (*imports.Options, error) {
+	opt := *options
+	switch argType {
+	case fromStdin:
+		opt.Fragment = true
+	case fromArchive:
+		opt.Overlay = archiveOverlay
+	}
+	cfg, err := configFor(filepath.Dir(target))
 	if err != nil {
-		report(err)
+		return nil, err
+	}
+	if cfg.Local != nil && !explicitFlags["local"] {
+		opt.LocalPrefix = strings.Join(cfg.Local, ",")
+	}
+	if cfg.Groups != nil && !explicitFlags["groups"] {
+		opt.Groups = cfg.Groups
 	}
-	return nil
+	if cfg.BlankDotGroups != nil && !explicitFlags["blank-dot-groups"] {
+		opt.BlankDotGroups = *cfg.BlankDotGroups
+	}
+	if cfg.RemoveRedundantAliases != nil && !explicitFlags["remove-redundant-aliases"] {
+		opt.RemoveRedundantAliases = *cfg.RemoveRedundantAliases
+	}
+	if len(cfg.Aliases) > 0 || len(aliases) > 0 {
+		opt.Aliases = map[string]string{}
+		for path, name := range cfg.Aliases {
+			opt.Aliases[path] = name
+		}
+		for path, name := range aliases {
+			opt.Aliases[path] = name
+		}
+	}
+	return &opt, nil
 }
 
-func walkDir(path string) {
-	_ = filepath.Walk(path, visitFile)
+// A fileJob is a file to be processed by processFiles. If err is non-nil,
+// the file could not be visited and err is reported in its place. If staged
+// is non-nil, the file's contents in the git index are processed instead of
+// the file itself.
+type fileJob struct {
+	path    string
+	argType argumentType
+	err     error
+	staged  *indexEntry
+}
+
+// walkDir appends the Go files in the tree rooted at root to jobs, skipping
+// vendor and testdata directories, the files and directories ignored by git,
+// and those excluded by configuration files, -exclude or -include.
+func walkDir(root string, jobs []fileJob) []fileJob {
+	walkTree(root, func(path string, f os.FileInfo, err error) {
+		if err != nil {
+			jobs = append(jobs, fileJob{path: path, err: err})
+		} else if isGoFile(f) {
+			jobs = append(jobs, fileJob{path: path, argType: multipleArg})
+		}
+	})
+	return jobs
+}
+
+// walkTree calls visit for root and each file and directory below it that
+// walkDir doesn't skip, or with the error that prevented visiting them.
+func walkTree(root string, visit func(path string, f os.FileInfo, err error)) {
+	// ignores holds the .gitignore rules applying in each directory visited.
+	ignores := map[string]*config.Ignore{}
+	_ = filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		parent := ignores[filepath.Dir(path)]
+		if err == nil && path != root {
+			var excluded bool
+			excluded, err = walkExcluded(root, path, f.IsDir(), parent)
+			if excluded {
+				if f.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+		if err == nil && f.IsDir() {
+			// Report a broken configuration file once, rather than
+			// for every file it applies to.
+			if _, err := configFor(path); err != nil {
+				visit(path, nil, err)
+				return filepath.SkipDir
+			}
+			ig, err := readIgnore(path, parent, path == root)
+			if err != nil {
+				visit(path, nil, err)
+				return filepath.SkipDir
+			}
+			ignores[filepath.Clean(path)] = ig
+		}
+		visit(path, f, err)
+		return nil
+	})
+}
+
+// isExcluded reports whether the configuration excludes path from walks.
+func isExcluded(path string, isDir bool) (bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	cfg, err := configFor(filepath.Dir(abs))
+	if err != nil {
+		return false, err
+	}
+	return cfg.Excluded(abs, isDir), nil
+}
+
+// processFiles runs processFile on each of jobs using up to *concurrency workers,
+// which share options.Env and therefore its resolver and caches.
+// Output and errors are reported in the order of jobs, no matter in which
+// order the workers finish them, so that the result is deterministic.
+func processFiles(jobs []fileJob) {
+	type result struct {
+		out  bytes.Buffer
+		err  error
+		done chan struct{}
+	}
+	results := make([]*result, len(jobs))
+	for i := range results {
+		results[i] = &result{done: make(chan struct{})}
+	}
+
+	next := make(chan int)
+	go func() {
+		for i := range jobs {
+			next <- i
+		}
+		close(next)
+	}()
+	workers := *concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := range next {
+				res := results[i]
+				res.err = processJob(jobs[i], &res.out)
+				close(res.done)
+			}
+		}()
+	}
+
+	for _, res := range results {
+		<-res.done
+		_, _ = os.Stdout.Write(res.out.Bytes())
+		if res.err != nil {
+			report(res.err)
+		}
+	}
+}
+
+// processJob processes the file of job, writing the output to out.
+func processJob(job fileJob, out io.Writer) error {
+	switch {
+	case job.err != nil:
+		// Files that could not be visited are part of the report too, so
+		// that it covers every file.
+		switch *outputFormat {
+		case "json":
+			return writeJSONReport(out, job.path, false, nil, job.err)
+		case "sarif":
+			return addSARIFResults(job.path, nil, nil, false, nil, job.err)
+		}
+		return job.err
+	case job.staged != nil:
+		return processStaged(job.path, job.staged, out)
+	}
+	return processFile(job.path, nil, out, job.argType, nil)
 }
 
 func main() {
@@ -217,6 +510,9 @@ var parseFlags = func() []string {
 	flag.BoolVar(&verbose, "v", false, "verbose logging")
 
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		explicitFlags[f.Name] = true
+	})
 	return flag.Args()
 }
 
@@ -278,18 +574,142 @@ func gofmtMain() {
 		return
 	}
 
+	if *configFile != "" {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			report(err)
+			return
+		}
+		explicitConfig = cfg
+	}
+
 	if verbose {
 		log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 		options.Env.Logf = log.Printf
 	}
+	switch *diffColor {
+	case "auto", "always", "never":
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -color value %q: must be auto, always or never\n", *diffColor)
+		exitCode = 2
+		return
+	}
+	switch *generated {
+	case "full":
+		options.Generated = imports.GeneratedFull
+	case "format-only":
+		options.Generated = imports.GeneratedFormatOnly
+	case "skip":
+		options.Generated = imports.GeneratedSkip
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -generated value %q: must be full, format-only or skip\n", *generated)
+		exitCode = 2
+		return
+	}
+	if *groups != "" {
+		options.Groups = strings.Split(*groups, ",")
+		if _, err := imports.ParseGrouping(options.Groups, ""); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -groups value %q: %v\n", *groups, err)
+			exitCode = 2
+			return
+		}
+	}
+	switch *outputFormat {
+	case "text", "json":
+	case "sarif":
+		// Results are collected while processing and written as one log.
+		defer writeSARIFLog(os.Stdout)
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -format value %q: must be text, json or sarif\n", *outputFormat)
+		exitCode = 2
+		return
+	}
+	switch *stdinFormat {
+	case "go":
+	case "txtar":
+		if *srcdir != "" && !isDir(*srcdir) {
+			fmt.Fprintf(os.Stderr, "-srcdir must be a directory with -stdin-format=txtar\n")
+			exitCode = 2
+			return
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "invalid -stdin-format value %q: must be go or txtar\n", *stdinFormat)
+		exitCode = 2
+		return
+	}
+	if *explain && *outputFormat != "text" {
+		fmt.Fprintf(os.Stderr, "-explain can't be used with -format=%s\n", *outputFormat)
+		exitCode = 2
+		return
+	}
+	if *explain && len(rewrites) > 0 {
+		fmt.Fprintf(os.Stderr, "-explain can't be used with -rewrite\n")
+		exitCode = 2
+		return
+	}
+	if *watch {
+		if *list || *doDiff || *check || *explain || *outputFormat != "text" || *changedSince != "" || *staged {
+			fmt.Fprintf(os.Stderr, "-watch can't be used with -l, -d, -check, -explain, -format, -changed-since or -staged\n")
+			exitCode = 2
+			return
+		}
+		*write = true
+	}
 	if options.TabWidth < 0 {
 		fmt.Fprintf(os.Stderr, "negative tabwidth %d\n", options.TabWidth)
 		exitCode = 2
 		return
 	}
 
+	afterDash := len(paths) > 0 && len(paths) < len(os.Args) && os.Args[len(os.Args)-len(paths)-1] == "--"
+	if cmd := subcommand(paths, afterDash); cmd != nil {
+		// The daemon and language server keep their caches warm
+		// themselves.
+		if err := cmd(paths[1:]); err != nil {
+			report(err)
+		}
+		return
+	}
+
+	if *socket != "" && daemon.Ping(*socket) {
+		useDaemon = true
+	}
+
+	if *watch {
+		if len(paths) == 0 {
+			paths = []string{"."}
+		}
+		watchMain(paths)
+		return
+	}
+
+	if *changedSince != "" || *staged {
+		var jobs []fileJob
+		var err error
+		switch {
+		case *changedSince != "" && *staged:
+			err = errors.New("-changed-since and -staged are mutually exclusive")
+		case *staged:
+			jobs, err = stagedFiles(paths)
+		default:
+			jobs, err = changedFiles(*changedSince, paths)
+		}
+		if err != nil {
+			report(err)
+			return
+		}
+		processFiles(jobs)
+		return
+	}
+
 	if len(paths) == 0 {
-		if err := processFile("<standard input>", os.Stdin, os.Stdout, fromStdin); err != nil {
+		var err error
+		if *stdinFormat == "txtar" {
+			err = processArchive(os.Stdin, os.Stdout)
+		} else {
+			err = processFile("<standard input>", os.Stdin, os.Stdout, fromStdin, nil)
+		}
+		if err != nil {
 			report(err)
 		}
 		return
@@ -300,90 +720,53 @@ func gofmtMain() {
 		argType = multipleArg
 	}
 
+	var jobs []fileJob
 	for _, path := range paths {
 		switch dir, err := os.Stat(path); {
 		case err != nil:
-			report(err)
+			jobs = append(jobs, fileJob{path: path, err: err})
 		case dir.IsDir():
-			walkDir(path)
+			jobs = walkDir(path, jobs)
 		default:
-			if err := processFile(path, nil, os.Stdout, argType); err != nil {
-				report(err)
-			}
+			jobs = append(jobs, fileJob{path: path, argType: argType})
 		}
 	}
+	processFiles(jobs)
 }
 
-func writeTempFile(dir, prefix string, data []byte) (string, error) {
-	file, err := os.CreateTemp(dir, prefix)
-	if err != nil {
-		return "", err
-	}
-	_, err = file.Write(data)
-	if err1 := file.Close(); err == nil {
-		err = err1
-	}
-	if err != nil {
-		os.Remove(file.Name())
-		return "", err
-	}
-	return file.Name(), nil
+// unifiedDiff returns the diff from src to res, a file named filename,
+// preceded by a line naming the compared files.
+func unifiedDiff(src, res []byte, filename string) []byte {
+	f := filepath.ToSlash(filename)
+	cmdline := fmt.Sprintf("diff -u %s %s", f+".orig", f)
+	oldName, newName := f+".orig", f
+	if *gitDiff {
+		cmdline = fmt.Sprintf("diff --git a/%s b/%s", f, f)
+		oldName, newName = "a/"+f, "b/"+f
+	}
+	color := useColor()
+	if color {
+		cmdline = "\x1b[1m" + cmdline + "\x1b[0m"
+	}
+	data := diff.Unified(oldName, newName, src, res, diff.Options{Context: *diffContext, Color: color})
+	return append([]byte(cmdline+"\n"), data...)
 }
 
-func diff(b1, b2 []byte, filename string) (data []byte, err error) {
-	f1, err := writeTempFile("", "gofmt", b1)
-	if err != nil {
-		return
-	}
-	defer os.Remove(f1)
-
-	f2, err := writeTempFile("", "gofmt", b2)
-	if err != nil {
-		return
-	}
-	defer os.Remove(f2)
-
-	cmd := "diff"
-	if runtime.GOOS == "plan9" {
-		cmd = "/bin/ape/diff"
-	}
-
-	data, err = exec.Command(cmd, "-u", f1, f2).CombinedOutput()
-	if len(data) > 0 {
-		// diff exits with a non-zero status when the files don't match.
-		// Ignore that failure as long as we get output.
-		return replaceTempFilename(data, filename)
+// useColor reports whether diffs should be colorized according to -color.
+// In auto mode, they are when standard output is a terminal and the
+// NO_COLOR environment variable is unset.
+func useColor() bool {
+	switch *diffColor {
+	case "always":
+		return true
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false
+		}
+		fi, err := os.Stdout.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0
 	}
-	return
-}
-
-// replaceTempFilename replaces temporary filenames in diff with actual one.
-//
-// --- /tmp/gofmt316145376	2017-02-03 19:13:00.280468375 -0500
-// +++ /tmp/gofmt617882815	2017-02-03 19:13:00.280468375 -0500
-// ...
-// ->
-// --- path/to/file.go.orig	2017-02-03 19:13:00.280468375 -0500
-// +++ path/to/file.go	2017-02-03 19:13:00.280468375 -0500
-// ...
-func replaceTempFilename(diff []byte, filename string) ([]byte, error) {
-	bs := bytes.SplitN(diff, []byte{'\n'}, 3)
-	if len(bs) < 3 {
-		return nil, fmt.Errorf("got unexpected diff for %s", filename)
-	}
-	// Preserve timestamps.
-	var t0, t1 []byte
-	if i := bytes.LastIndexByte(bs[0], '\t'); i != -1 {
-		t0 = bs[0][i:]
-	}
-	if i := bytes.LastIndexByte(bs[1], '\t'); i != -1 {
-		t1 = bs[1][i:]
-	}
-	// Always print filepath with slash separator.
-	f := filepath.ToSlash(filename)
-	bs[0] = []byte(fmt.Sprintf("--- %s%s", f+".orig", t0))
-	bs[1] = []byte(fmt.Sprintf("+++ %s%s", f, t1))
-	return bytes.Join(bs, []byte{'\n'}), nil
+	return false
 }
 
 // isFile reports whether name is a file.
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSubcommand(t *testing.T) {
+	chdir(t, t.TempDir())
+	for _, tt := range []struct {
+		args      []string
+		afterDash bool
+		flags     []string
+		want      bool
+	}{
+		{args: []string{"lsp"}, want: true},
+		{args: []string{"lsp"}, flags: []string{"format", "local"}, want: true},
+		{args: []string{"lsp"}, flags: []string{"w"}, want: false},
+		{args: []string{"lsp"}, flags: []string{"l"}, afterDash: true, want: true},
+		{args: []string{"main.go"}, afterDash: true, want: false},
+		{args: nil, want: false},
+	} {
+		old := explicitFlags
+		explicitFlags = map[string]bool{}
+		for _, name := range tt.flags {
+			explicitFlags[name] = true
+		}
+		if got := subcommand(tt.args, tt.afterDash) != nil; got != tt.want {
+			t.Errorf("subcommand(%q, %v) with flags %q run: %v, want %v", tt.args, tt.afterDash, tt.flags, got, tt.want)
+		}
+		explicitFlags = old
+	}
+
+	// A directory named after a subcommand is processed instead.
+	if err := os.Mkdir("lsp", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if subcommand([]string{"lsp"}, false) != nil {
+		t.Errorf("subcommand run with a directory of the same name")
+	}
+	if subcommand([]string{"lsp"}, true) == nil {
+		t.Errorf("subcommand not run after --")
+	}
+}
+
+// captureOutput returns what f writes to standard output and standard
+// error, in the order it is written.
+func captureOutput(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	out := make(chan string)
+	go func() {
+		b, _ := io.ReadAll(r)
+		out <- string(b)
+	}()
+	f()
+	os.Stdout, os.Stderr = stdout, stderr
+	w.Close()
+	return <-out
+}
+
+func TestProcessFilesOrder(t *testing.T) {
+	setFlag(t, list, true)
+	setFlag(t, concurrency, 4)
+	setFlag(t, socket, "")
+	dir := t.TempDir()
+	files := map[string]string{}
+	var jobs []fileJob
+	var want []string
+	for i := 0; i < 24; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("f%02d.go", i))
+		switch i % 3 {
+		case 0:
+			files[filepath.Base(name)] = "package p\n\nimport \"os\"\n"
+			want = append(want, name)
+		case 1:
+			files[filepath.Base(name)] = "package p\n\nfunc {\n"
+			want = append(want, name+":3:6: ")
+		case 2:
+			files[filepath.Base(name)] = "package p\n"
+		}
+		jobs = append(jobs, fileJob{path: name, argType: multipleArg})
+	}
+	writeFiles(t, dir, files)
+
+	out := captureOutput(t, func() { processFiles(jobs) })
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), out)
+	}
+	for i, line := range lines {
+		if !strings.HasPrefix(line, want[i]) || !strings.HasSuffix(want[i], " ") && line != want[i] {
+			t.Errorf("line %d = %q, want %q", i+1, line, want[i])
+		}
+	}
+	if exitCode != 2 {
+		t.Errorf("exit status %d, want 2", exitCode)
+	}
+}
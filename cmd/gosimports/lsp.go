@@ -0,0 +1,28 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/rinchsan/gosimports/internal/imports"
+	"github.com/rinchsan/gosimports/internal/lsp"
+)
+
+// lspMain runs a language server over standard input and output, for
+// editors to format files and fix their imports without starting a new
+// process, and so scanning the module graph again, on every save.
+func lspMain(args []string) error {
+	if len(args) > 0 {
+		return errors.New("usage: gosimports [flags] lsp")
+	}
+	s := &lsp.Server{
+		Options: func(filename string) (*imports.Options, error) {
+			return fileOptions(filename, singleArg)
+		},
+		Env:     options.Env,
+		Version: parseVersion(),
+		Logf:    log.Printf,
+	}
+	return s.Serve(os.Stdin, os.Stdout)
+}
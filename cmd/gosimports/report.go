@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"go/scanner"
+	"io"
+	"sort"
+
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// A fileReport is the record printed for each file with -format=json.
+type fileReport struct {
+	Path      string         `json:"path"`
+	Changed   bool           `json:"changed"`
+	Added     []importReport `json:"added,omitempty"`
+	Removed   []importReport `json:"removed,omitempty"`
+	Renamed   []importReport `json:"renamed,omitempty"`   // with the name now used
+	Conflicts []importReport `json:"conflicts,omitempty"` // not named as the alias policy requires, with the name required
+	Errors    []string       `json:"errors,omitempty"`
+}
+
+// An importReport describes an import statement.
+type importReport struct {
+	Path string `json:"path"`
+	Name string `json:"name,omitempty"`
+}
+
+// newFileReport returns the report for filename, given the outcome of
+// processing it.
+func newFileReport(filename string, changed bool, fixes []*imports.ImportFix, err error) *fileReport {
+	r := &fileReport{Path: filename, Changed: changed}
+	for _, fix := range fixes {
+		imp := importReport{Path: fix.StmtInfo.ImportPath, Name: fix.StmtInfo.Name}
+		switch fix.FixType {
+		case imports.AddImport:
+			r.Added = append(r.Added, imp)
+		case imports.DeleteImport:
+			r.Removed = append(r.Removed, imp)
+		case imports.SetImportName:
+			r.Renamed = append(r.Renamed, imp)
+		case imports.AliasConflict:
+			r.Conflicts = append(r.Conflicts, imp)
+		}
+	}
+	for _, imps := range [][]importReport{r.Added, r.Removed, r.Renamed, r.Conflicts} {
+		sort.Slice(imps, func(i, j int) bool { return imps[i].Path < imps[j].Path })
+	}
+
+	if list, ok := err.(scanner.ErrorList); ok {
+		for _, e := range list {
+			r.Errors = append(r.Errors, e.Error())
+		}
+	} else if err != nil {
+		r.Errors = append(r.Errors, err.Error())
+	}
+	return r
+}
+
+// writeJSONReport writes the report for filename to out as a line of JSON.
+// If err is non-nil, it is part of the report rather than returned, but
+// still determines the exit status.
+func writeJSONReport(out io.Writer, filename string, changed bool, fixes []*imports.ImportFix, err error) error {
+	if err != nil {
+		setExitCode(2)
+	}
+	data, err := json.Marshal(newFileReport(filename, changed, fixes, err))
+	if err != nil {
+		return err
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setFlag sets *p to v for the duration of the test, along with resetting
+// the exit status afterwards.
+func setFlag[T any](t *testing.T, p *T, v T) {
+	old := *p
+	*p = v
+	t.Cleanup(func() {
+		*p = old
+		exitCode = 0
+	})
+}
+
+// writeFiles creates the files with the given contents, named relative to
+// dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	setFlag(t, outputFormat, "json")
+	setFlag(t, socket, "")
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"changed.go":   "package p\n\nimport \"os\"\n",
+		"unchanged.go": "package p\n",
+		"broken.go":    "package p\n\nfunc {\n",
+		// A broken configuration file makes the walk fail for sub.
+		"sub/.gosimports.toml": "local =\n",
+		"sub/x.go":             "package sub\n",
+	})
+	missing := filepath.Join(dir, "missing.go")
+	_, statErr := os.Stat(missing)
+
+	jobs := walkDir(dir, nil)
+	jobs = append(jobs, fileJob{path: missing, err: statErr})
+	var out bytes.Buffer
+	for _, job := range jobs {
+		if err := processJob(job, &out); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []fileReport
+	dec := json.NewDecoder(&out)
+	for dec.More() {
+		var r fileReport
+		if err := dec.Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		r.Path = filepath.Base(r.Path)
+		got = append(got, r)
+	}
+	// The messages of syntax errors are up to their packages.
+	for i := range got {
+		if len(got[i].Errors) == 1 && got[i].Path != "missing.go" {
+			got[i].Errors = []string{"syntax error"}
+		}
+	}
+	want := []fileReport{
+		{Path: "broken.go", Errors: []string{"syntax error"}},
+		{Path: "changed.go", Changed: true, Removed: []importReport{{Path: "os"}}},
+		{Path: "sub", Errors: []string{"syntax error"}},
+		{Path: "unchanged.go"},
+		{Path: "missing.go", Errors: []string{statErr.Error()}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("records =\n%+v\nwant\n%+v", got, want)
+	}
+	if exitCode != 2 {
+		t.Errorf("exit status %d, want 2", exitCode)
+	}
+}
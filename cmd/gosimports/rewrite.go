@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// A rewriteMap is a flag.Value collecting the old=>new pairs of -rewrite.
+type rewriteMap map[string]string
+
+func (m rewriteMap) String() string {
+	var pairs []string
+	for old, new := range m {
+		pairs = append(pairs, old+"=>"+new)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m rewriteMap) Set(s string) error {
+	old, new, ok := strings.Cut(s, "=>")
+	if !ok {
+		return fmt.Errorf("%q is not of the form old=>new", s)
+	}
+	old, new = strings.TrimSuffix(old, "/"), strings.TrimSuffix(new, "/")
+	if old == "" || new == "" || old == "C" || new == "C" {
+		return fmt.Errorf("invalid import path rewrite %q", s)
+	}
+	m[old] = new
+	return nil
+}
+
+var rewrites = rewriteMap{} // -rewrite
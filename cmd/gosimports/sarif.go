@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"path/filepath"
+	"sort"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// The types below are the subset of the SARIF 2.1.0 object model that
+// -format=sarif produces. See https://docs.oasis-open.org/sarif/sarif/v2.1.0/.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool        sarifTool         `json:"tool"`
+	ColumnKind  string            `json:"columnKind"`
+	Results     []sarifResult     `json:"results"`
+	Invocations []sarifInvocation `json:"invocations"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+	FullDescription  sarifMessage `json:"fullDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Fixes     []sarifFix      `json:"fixes,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+// sarifRules are the rules results are reported under: one for each kind
+// of imports.ImportFix, and two for changes not caused by a fix.
+var sarifRules = []sarifRule{
+	{
+		ID:               "AddImport",
+		ShortDescription: sarifMessage{"Missing import"},
+		FullDescription:  sarifMessage{"The file refers to a package that it does not import."},
+	},
+	{
+		ID:               "DeleteImport",
+		ShortDescription: sarifMessage{"Unused import"},
+		FullDescription:  sarifMessage{"The file imports a package that it does not use."},
+	},
+	{
+		ID:               "SetImportName",
+		ShortDescription: sarifMessage{"Missing import name"},
+		FullDescription:  sarifMessage{"The name of the imported package differs from the one implied by its import path, so the import must name it."},
+	},
+	{
+		ID:               "AliasConflict",
+		ShortDescription: sarifMessage{"Import alias conflict"},
+		FullDescription:  sarifMessage{"The alias policy requires a name for the import that the file uses for something else."},
+	},
+	{
+		ID:               "Regroup",
+		ShortDescription: sarifMessage{"Imports not grouped"},
+		FullDescription:  sarifMessage{"The imports are not sorted and grouped the way gosimports does."},
+	},
+	{
+		ID:               "Format",
+		ShortDescription: sarifMessage{"File not formatted"},
+		FullDescription:  sarifMessage{"The file is not formatted the way gofmt does."},
+	},
+}
+
+const (
+	ruleAliasConflict = "AliasConflict"
+	ruleRegroup       = "Regroup"
+	ruleFormat        = "Format"
+)
+
+var sarifRuleIndex = func() map[string]int {
+	m := map[string]int{}
+	for i, r := range sarifRules {
+		m[r.ID] = i
+	}
+	return m
+}()
+
+// sarif accumulates the results of -format=sarif, which are printed as a
+// single log once all files have been processed.
+var sarif struct {
+	mu            sync.Mutex
+	results       map[string][]sarifResult // by file URI
+	notifications []sarifNotification
+}
+
+// addSARIFResults records the results for filename, given the outcome of
+// processing it. If err is non-nil, it is recorded rather than returned,
+// but still determines the exit status.
+func addSARIFResults(filename string, src, res []byte, changed bool, fixes []*imports.ImportFix, err error) error {
+	uri := filepath.ToSlash(filename)
+	sarif.mu.Lock()
+	defer sarif.mu.Unlock()
+	if sarif.results == nil {
+		sarif.results = map[string][]sarifResult{}
+	}
+	if err != nil {
+		setExitCode(2)
+		sarif.notifications = append(sarif.notifications, sarifNotification{
+			Level:     "error",
+			Message:   sarifMessage{err.Error()},
+			Locations: []sarifLocation{{sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{uri}, Region: sarifRegion{1, 1, 1, 1}}}},
+		})
+		return nil
+	}
+	var results []sarifResult
+	if changed {
+		results = sarifResults(uri, src, res, fixes)
+	}
+	results = append(results, conflictResults(uri, src, fixes)...)
+	if len(results) > 0 {
+		sarif.results[uri] = results
+	}
+	return nil
+}
+
+// sarifResults returns the results for the file at uri, whose source src
+// was changed to res by fixes.
+func sarifResults(uri string, src, res []byte, fixes []*imports.ImportFix) []sarifResult {
+	oldSpan, okOld := findImportSpan(src)
+	newSpan, okNew := findImportSpan(res)
+	if !okOld || !okNew {
+		// Without a syntax tree, report the whole file as misformatted.
+		return []sarifResult{{
+			RuleID:    ruleFormat,
+			RuleIndex: sarifRuleIndex[ruleFormat],
+			Level:     "warning",
+			Message:   sarifMessage{"file is not formatted"},
+			Locations: []sarifLocation{location(uri, src, 0, len(src))},
+			Fixes: []sarifFix{{
+				Description:     sarifMessage{"Format the file"},
+				ArtifactChanges: []sarifArtifactChange{{sarifArtifactLocation{uri}, []sarifReplacement{replacement(src, 0, len(src), res)}}},
+			}},
+		}}
+	}
+
+	var results []sarifResult
+	block := location(uri, src, oldSpan.blockStart, oldSpan.blockEnd)
+	oldImports, newImports := src[oldSpan.fixStart:oldSpan.end], res[newSpan.fixStart:newSpan.end]
+	if !bytes.Equal(oldImports, newImports) {
+		fix := sarifFix{
+			Description: sarifMessage{"Fix the imports"},
+			ArtifactChanges: []sarifArtifactChange{{
+				sarifArtifactLocation{uri},
+				[]sarifReplacement{replacement(src, oldSpan.fixStart, oldSpan.end, newImports)},
+			}},
+		}
+		var sorted []*imports.ImportFix
+		for _, f := range fixes {
+			if f.FixType != imports.AliasConflict {
+				sorted = append(sorted, f)
+			}
+		}
+		sort.Slice(sorted, func(i, j int) bool {
+			if sorted[i].FixType != sorted[j].FixType {
+				return sorted[i].FixType < sorted[j].FixType
+			}
+			return sorted[i].StmtInfo.ImportPath < sorted[j].StmtInfo.ImportPath
+		})
+		// The replacement of the imports fixes them all at once, so it
+		// comes with the first result only: applying it from each result
+		// would replace the block several times.
+		for i, f := range sorted {
+			id := []string{"AddImport", "DeleteImport", "SetImportName"}[f.FixType]
+			result := sarifResult{
+				RuleID:    id,
+				RuleIndex: sarifRuleIndex[id],
+				Level:     "warning",
+				Message:   sarifMessage{fixMessage(f)},
+				Locations: []sarifLocation{block},
+			}
+			if i == 0 {
+				result.Fixes = []sarifFix{fix}
+			}
+			results = append(results, result)
+		}
+		if len(sorted) == 0 {
+			results = append(results, sarifResult{
+				RuleID:    ruleRegroup,
+				RuleIndex: sarifRuleIndex[ruleRegroup],
+				Level:     "warning",
+				Message:   sarifMessage{"imports are not sorted and grouped"},
+				Locations: []sarifLocation{block},
+				Fixes:     []sarifFix{fix},
+			})
+		}
+	}
+
+	// Report formatting changes outside of the imports separately, with
+	// their own minimal replacements.
+	var repls []sarifReplacement
+	var first *sarifLocation
+	for _, part := range []struct {
+		base     int
+		old, new []byte
+	}{
+		{0, src[:oldSpan.fixStart], res[:newSpan.fixStart]},
+		{oldSpan.end, src[oldSpan.end:], res[newSpan.end:]},
+	} {
+		start, end, text := trimCommon(part.old, part.new)
+		if start == end && len(text) == 0 {
+			continue
+		}
+		base := part.base
+		repls = append(repls, replacement(src, base+start, base+end, text))
+		if first == nil {
+			loc := location(uri, src, base+start, base+end)
+			first = &loc
+		}
+	}
+	if first != nil {
+		results = append(results, sarifResult{
+			RuleID:    ruleFormat,
+			RuleIndex: sarifRuleIndex[ruleFormat],
+			Level:     "warning",
+			Message:   sarifMessage{"file is not formatted"},
+			Locations: []sarifLocation{*first},
+			Fixes: []sarifFix{{
+				Description:     sarifMessage{"Format the file"},
+				ArtifactChanges: []sarifArtifactChange{{sarifArtifactLocation{uri}, repls}},
+			}},
+		})
+	}
+	return results
+}
+
+// conflictResults returns the results for the alias conflicts among the
+// fixes of the file at uri, whose source is src. They come with no fix.
+func conflictResults(uri string, src []byte, fixes []*imports.ImportFix) []sarifResult {
+	var results []sarifResult
+	for _, f := range aliasConflicts(fixes) {
+		loc := location(uri, src, 0, 0)
+		if span, ok := findImportSpan(src); ok {
+			loc = location(uri, src, span.blockStart, span.blockEnd)
+		}
+		results = append(results, sarifResult{
+			RuleID:    ruleAliasConflict,
+			RuleIndex: sarifRuleIndex[ruleAliasConflict],
+			Level:     "warning",
+			Message:   sarifMessage{conflictMessage(f)},
+			Locations: []sarifLocation{loc},
+		})
+	}
+	return results
+}
+
+func fixMessage(f *imports.ImportFix) string {
+	spec := fmt.Sprintf("%q", f.StmtInfo.ImportPath)
+	if f.StmtInfo.Name != "" {
+		spec = f.StmtInfo.Name + " " + spec
+	}
+	switch f.FixType {
+	case imports.AddImport:
+		return "add missing import " + spec
+	case imports.DeleteImport:
+		return "remove unused import " + spec
+	default:
+		return "import " + spec
+	}
+}
+
+// An importSpan locates the imports of a file, as byte offsets.
+type importSpan struct {
+	blockStart, blockEnd int // the import declarations, or the package clause if there are none
+	fixStart, end        int // from the end of the package clause to the end of the imports
+}
+
+// findImportSpan returns the import span of src, reporting whether src could be
+// parsed far enough to determine it.
+func findImportSpan(src []byte) (importSpan, bool) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return importSpan{}, false
+	}
+	offset := func(p token.Pos) int { return fset.Position(p).Offset }
+	s := importSpan{
+		blockStart: offset(f.Package),
+		blockEnd:   offset(f.Name.End()),
+		fixStart:   offset(f.Name.End()),
+		end:        offset(f.Name.End()),
+	}
+	var decls []*ast.GenDecl
+	for _, d := range f.Decls {
+		if d, ok := d.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			decls = append(decls, d)
+		}
+	}
+	if len(decls) > 0 {
+		s.blockStart = offset(decls[0].Pos())
+		s.blockEnd = offset(decls[len(decls)-1].End())
+		s.end = s.blockEnd
+	}
+	return s, true
+}
+
+// trimCommon returns the smallest range [start, end) of old that must be
+// replaced by text to turn old into new.
+func trimCommon(old, new []byte) (start, end int, text []byte) {
+	for start < len(old) && start < len(new) && old[start] == new[start] {
+		start++
+	}
+	end = len(old)
+	newEnd := len(new)
+	for end > start && newEnd > start && old[end-1] == new[newEnd-1] {
+		end--
+		newEnd--
+	}
+	return start, end, new[start:newEnd]
+}
+
+func location(uri string, src []byte, start, end int) sarifLocation {
+	return sarifLocation{sarifPhysicalLocation{
+		ArtifactLocation: sarifArtifactLocation{uri},
+		Region:           region(src, start, end),
+	}}
+}
+
+func replacement(src []byte, start, end int, text []byte) sarifReplacement {
+	return sarifReplacement{DeletedRegion: region(src, start, end), InsertedContent: sarifMessage{string(text)}}
+}
+
+// region returns the region of src between the byte offsets start and end,
+// with one-based lines and columns counted in Unicode code points.
+func region(src []byte, start, end int) sarifRegion {
+	pos := func(off int) (line, col int) {
+		lineStart := bytes.LastIndexByte(src[:off], '\n') + 1
+		return bytes.Count(src[:off], []byte("\n")) + 1, utf8.RuneCount(src[lineStart:off]) + 1
+	}
+	var r sarifRegion
+	r.StartLine, r.StartColumn = pos(start)
+	r.EndLine, r.EndColumn = pos(end)
+	return r
+}
+
+// writeSARIFLog writes the accumulated results to w as a SARIF log.
+func writeSARIFLog(w io.Writer) {
+	sarif.mu.Lock()
+	defer sarif.mu.Unlock()
+
+	uris := make([]string, 0, len(sarif.results))
+	for uri := range sarif.results {
+		uris = append(uris, uri)
+	}
+	sort.Strings(uris)
+	results := []sarifResult{}
+	for _, uri := range uris {
+		results = append(results, sarif.results[uri]...)
+	}
+
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{sarifDriver{
+				Name:           "gosimports",
+				Version:        parseVersion(),
+				InformationURI: "https://github.com/rinchsan/gosimports",
+				Rules:          sarifRules,
+			}},
+			ColumnKind: "unicodeCodePoints",
+			Results:    results,
+			Invocations: []sarifInvocation{{
+				ExecutionSuccessful:        len(sarif.notifications) == 0,
+				ToolExecutionNotifications: sarif.notifications,
+			}},
+		}},
+	}
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		report(err)
+		return
+	}
+	_, _ = w.Write(append(data, '\n'))
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func TestSARIFLog(t *testing.T) {
+	golden, err := filepath.Abs(filepath.Join("testdata", "sarif.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFlag(t, outputFormat, "sarif")
+	setFlag(t, socket, "")
+	setFlag(t, &version, "v0.0.0-test")
+	t.Cleanup(func() {
+		sarif.results = nil
+		sarif.notifications = nil
+	})
+	chdir(t, t.TempDir())
+	writeFiles(t, ".", map[string]string{
+		"changed.go":   "package p\n\nimport (\n\t\"os\"\n\t\"io\"\n\t\"fmt\"\n)\n\nvar _ = fmt.Println\n\nfunc  f() {}\n",
+		"regroup.go":   "package p\n\nimport (\n\t\"os\"\n\t\"fmt\"\n)\n\nvar _, _ = fmt.Print, os.Exit\n",
+		"unchanged.go": "package p\n\nimport \"fmt\"\n\nvar _ = fmt.Sprint\n",
+		"broken.go":    "package p\n\nfunc {\n",
+	})
+
+	jobs := walkDir(".", nil)
+	_, statErr := os.Stat("missing.go")
+	jobs = append(jobs, fileJob{path: "missing.go", err: statErr})
+	for _, job := range jobs {
+		if err := processJob(job, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got bytes.Buffer
+	writeSARIFLog(&got)
+
+	if *update {
+		if err := os.WriteFile(golden, got.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), want) {
+		t.Errorf("SARIF log differs from %s (run with -update to accept it):\n%s", golden, unifiedDiff(want, got.Bytes(), "sarif.golden"))
+	}
+	if exitCode != 2 {
+		t.Errorf("exit status %d, want 2", exitCode)
+	}
+}
+
+// chdir changes the current directory to dir for the duration of the test.
+func chdir(t *testing.T, dir string) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/rinchsan/gosimports/internal/config"
+)
+
+// A globList is a flag.Value collecting the globs of a repeatable flag.
+type globList []string
+
+func (l *globList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *globList) Set(glob string) error {
+	*l = append(*l, glob)
+	return nil
+}
+
+var (
+	excludes globList // -exclude
+	includes globList // -include
+)
+
+// defaultExcludes are the directories skipped when walking directories,
+// unless named on the command line: vendored dependencies and test data
+// are not the project's own code.
+var defaultExcludes = []string{"vendor/", "testdata/"}
+
+// flagExcluded reports whether the file or directory at path, found below
+// the directory root, is excluded by default or by -exclude, or is a file
+// not matching -include when given.
+func flagExcluded(root, path string, isDir bool) (bool, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return false, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	for _, glob := range append(defaultExcludes[:len(defaultExcludes):len(defaultExcludes)], excludes...) {
+		if (config.Pattern{Dir: absRoot, Glob: glob}).Match(abs, isDir) {
+			return true, nil
+		}
+	}
+	if isDir || len(includes) == 0 {
+		return false, nil
+	}
+	for _, glob := range includes {
+		if (config.Pattern{Dir: absRoot, Glob: glob}).Match(abs, isDir) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// walkExcluded reports whether walking the directory root skips the file or
+// directory at path, given the .gitignore rules ig applying in its directory.
+func walkExcluded(root, path string, isDir bool, ig *config.Ignore) (bool, error) {
+	if excluded, err := flagExcluded(root, path, isDir); excluded || err != nil {
+		return excluded, err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false, err
+	}
+	if ig.Ignored(abs, isDir) {
+		return true, nil
+	}
+	return isExcluded(path, isDir)
+}
+
+// readIgnore returns the .gitignore rules applying in the directory dir,
+// given those of its parent directory. The rules for the root of a walk
+// are read from the parents of dir too.
+func readIgnore(dir string, parent *config.Ignore, isRoot bool) (*config.Ignore, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if isRoot {
+		return config.IgnoreFor(abs)
+	}
+	return parent.ReadDir(abs)
+}
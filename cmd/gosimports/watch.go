@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rinchsan/gosimports/internal/config"
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+const (
+	// watchDebounce is how long changes must stop before the files changed
+	// are processed, so that a burst of events, such as when an editor
+	// saves through a temporary file or a branch is checked out, is
+	// handled once.
+	watchDebounce = 100 * time.Millisecond
+
+	// pollInterval is how often the trees are walked for changes when the
+	// system can't notify gosimports of them.
+	pollInterval = time.Second
+)
+
+// A watcher signals that something may have changed in the directories it
+// watches.
+type watcher interface {
+	// add watches the directory dir, if it isn't already.
+	add(dir string) error
+	// changes returns a channel receiving the paths of the files and
+	// directories that changed, or nil if anything may have changed.
+	changes() <-chan []string
+	// err returns the error that closed the channel of changes, if any.
+	err() error
+}
+
+// A poller is a watcher ticking every pollInterval.
+type poller struct{ ticker *time.Ticker }
+
+func (p poller) add(string) error { return nil }
+
+func (p poller) changes() <-chan []string {
+	c := make(chan []string)
+	go func() {
+		for range p.ticker.C {
+			c <- nil
+		}
+	}()
+	return c
+}
+
+func (p poller) err() error { return nil }
+
+// A fileStamp identifies a version of a file.
+type fileStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// watchMain processes the Go files below paths, as walkDir finds them,
+// whenever they change, until interrupted.
+func watchMain(paths []string) {
+	w, err := newWatcher()
+	if err != nil {
+		if verbose {
+			log.Printf("watching for changes every %v: %v", pollInterval, err)
+		}
+		w = poller{time.NewTicker(pollInterval)}
+	}
+
+	seen, errs := watchScan(paths, w)
+	processFiles(errs)
+	reported := walkErrors(errs)
+	changes := w.changes()
+	for {
+		events, ok := <-changes
+		// Wait for the burst of changes to end.
+		rescan := events == nil
+		for quiet := false; ok && !quiet; {
+			select {
+			case more, open := <-changes:
+				ok = open
+				rescan = rescan || more == nil
+				events = append(events, more...)
+			case <-time.After(watchDebounce):
+				quiet = true
+			}
+		}
+		if !ok {
+			// Poll from now on, walking the trees again for the changes
+			// missed meanwhile.
+			report(fmt.Errorf("watching for changes every %v: %v", pollInterval, w.err()))
+			w = poller{time.NewTicker(pollInterval)}
+			changes = w.changes()
+		}
+
+		var jobs []fileJob
+		if rescan || needsRescan(events, seen) {
+			var files map[string]fileStamp
+			files, errs = watchScan(paths, w)
+			// Only report the errors walking the trees when they first
+			// occur, not on every change.
+			for _, job := range errs {
+				if !reported[job.path+": "+job.err.Error()] {
+					jobs = append(jobs, job)
+				}
+			}
+			reported = walkErrors(errs)
+			jobs = append(jobs, modifiedFiles(seen, files)...)
+			seen = files
+		} else {
+			jobs = checkEvents(seen, events)
+		}
+		// The files are recorded as seen with the versions found before
+		// processing them, so that changes made while they are processed
+		// are noticed. Those written here are processed once more, to no
+		// effect.
+		processFiles(jobs)
+	}
+}
+
+// modifiedFiles returns the jobs for the files whose versions in files
+// aren't those in seen, sorted by path.
+func modifiedFiles(seen, files map[string]fileStamp) []fileJob {
+	var changed []fileJob
+	for path, st := range files {
+		if old, ok := seen[path]; !ok || old != st {
+			changed = append(changed, fileJob{path: path, argType: multipleArg})
+		}
+	}
+	sort.Slice(changed, func(i, j int) bool { return changed[i].path < changed[j].path })
+	return changed
+}
+
+// checkEvents returns the jobs for the files seen among paths whose
+// versions changed, and records their current versions in seen.
+func checkEvents(seen map[string]fileStamp, paths []string) []fileJob {
+	files := map[string]fileStamp{}
+	for _, path := range paths {
+		if _, ok := seen[path]; !ok {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			files[path] = fileStamp{fi.Size(), fi.ModTime()}
+		} else {
+			delete(seen, path)
+		}
+	}
+	jobs := modifiedFiles(seen, files)
+	for path, st := range files {
+		seen[path] = st
+	}
+	return jobs
+}
+
+// needsRescan reports whether the changes of the files and directories at
+// paths require walking the trees again, rather than checking the Go files
+// seen among them: whether there may be new Go files or directories, or
+// the files selecting them changed.
+func needsRescan(paths []string, seen map[string]fileStamp) bool {
+	for _, path := range paths {
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		switch filepath.Base(path) {
+		case ".gitignore", config.FileName:
+			return true
+		}
+		if fi, err := os.Lstat(path); err == nil && (fi.IsDir() || isGoFile(fi)) {
+			return true
+		}
+	}
+	return false
+}
+
+// walkErrors returns the set of the errors of jobs.
+func walkErrors(jobs []fileJob) map[string]bool {
+	errs := map[string]bool{}
+	for _, job := range jobs {
+		errs[job.path+": "+job.err.Error()] = true
+	}
+	return errs
+}
+
+// watchScan returns the versions of the Go files below paths and the
+// errors walking them, and makes sure w watches the directories walked.
+func watchScan(paths []string, w watcher) (map[string]fileStamp, []fileJob) {
+	files := map[string]fileStamp{}
+	var errs []fileJob
+	for _, root := range paths {
+		walkTree(root, func(path string, f os.FileInfo, err error) {
+			if err == nil && f.IsDir() {
+				err = w.add(path)
+			} else if err == nil && (path == root || isGoFile(f)) {
+				files[path] = fileStamp{f.Size(), f.ModTime()}
+				if path == root {
+					err = w.add(filepath.Dir(path))
+				}
+			}
+			if err != nil {
+				errs = append(errs, fileJob{path: path, err: err})
+			}
+		})
+	}
+	return files, errs
+}
+
+// describeFixes summarizes fixes for -watch, such as `add "fmt", remove "os"`.
+func describeFixes(fixes []*imports.ImportFix) string {
+	if len(fixes) == 0 {
+		return "formatted"
+	}
+	var s []string
+	for _, f := range fixes {
+		s = append(s, describeFix(f))
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,112 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyMask selects the events signaling that files may have been
+// created, modified, moved or deleted.
+const inotifyMask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// An inotifyWatcher watches directories with inotify(7).
+type inotifyWatcher struct {
+	fd      int
+	readErr error // the error that closed the channel of changes
+
+	mu      sync.Mutex
+	dirs    map[string]bool  // directories watched
+	wdNames map[int32]string // watched directories by watch descriptor
+}
+
+// newWatcher returns the watcher of the system, if it supports one.
+func newWatcher() (watcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	return &inotifyWatcher{fd: fd, dirs: map[string]bool{}, wdNames: map[int32]string{}}, nil
+}
+
+func (w *inotifyWatcher) add(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dirs[dir] {
+		return nil
+	}
+	wd, err := unix.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		return &os.PathError{Op: "inotify_add_watch", Path: dir, Err: err}
+	}
+	w.dirs[dir] = true
+	w.wdNames[int32(wd)] = dir
+	return nil
+}
+
+func (w *inotifyWatcher) changes() <-chan []string {
+	c := make(chan []string)
+	go func() {
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := unix.Read(w.fd, buf)
+			if err == unix.EINTR {
+				continue
+			}
+			if err != nil || n <= 0 {
+				if err == nil {
+					err = io.ErrUnexpectedEOF
+				}
+				w.readErr = os.NewSyscallError("read", err)
+				close(c)
+				return
+			}
+			c <- w.events(buf[:n])
+		}
+	}()
+	return c
+}
+
+func (w *inotifyWatcher) err() error { return w.readErr }
+
+// events returns the paths of the files and directories changed according
+// to the events in buf. It forgets the directories whose watch was removed
+// by the kernel, because they were deleted, so that they are watched again
+// if they are created anew. It returns nil if the kernel queue overflowed
+// and events were lost.
+func (w *inotifyWatcher) events(buf []byte) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	paths := []string{}
+	overflow := false
+	for len(buf) >= unix.SizeofInotifyEvent {
+		ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		name := buf[unix.SizeofInotifyEvent : unix.SizeofInotifyEvent+int(ev.Len)]
+		if i := bytes.IndexByte(name, 0); i >= 0 {
+			name = name[:i]
+		}
+		if dir, ok := w.wdNames[ev.Wd]; ok && len(name) > 0 {
+			paths = append(paths, filepath.Join(dir, string(name)))
+		}
+		if ev.Mask&unix.IN_Q_OVERFLOW != 0 {
+			overflow = true
+		}
+		if ev.Mask&unix.IN_IGNORED != 0 {
+			delete(w.dirs, w.wdNames[ev.Wd])
+			delete(w.wdNames, ev.Wd)
+		}
+		buf = buf[unix.SizeofInotifyEvent+int(ev.Len):]
+	}
+	if overflow {
+		return nil
+	}
+	return paths
+}
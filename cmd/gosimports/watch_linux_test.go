@@ -0,0 +1,56 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyEvent returns the bytes of an event of the watch descriptor wd
+// for the file name.
+func inotifyEvent(wd int32, mask uint32, name string) []byte {
+	n := 0
+	if name != "" {
+		n = len(name) + 1
+	}
+	buf := make([]byte, unix.SizeofInotifyEvent+n)
+	ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[0]))
+	ev.Wd, ev.Mask, ev.Len = wd, mask, uint32(n)
+	copy(buf[unix.SizeofInotifyEvent:], name)
+	return buf
+}
+
+func TestInotifyEvents(t *testing.T) {
+	dir := t.TempDir()
+	w := &inotifyWatcher{dirs: map[string]bool{dir: true}, wdNames: map[int32]string{1: dir}}
+	buf := append(inotifyEvent(1, unix.IN_CLOSE_WRITE, "a.go"), inotifyEvent(1, unix.IN_CREATE, "b.go")...)
+	if got, want := w.events(buf), []string{filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+	if got := w.events(nil); got == nil {
+		t.Errorf("events without any = nil, want none")
+	}
+	buf = append(inotifyEvent(1, unix.IN_CLOSE_WRITE, "a.go"), inotifyEvent(-1, unix.IN_Q_OVERFLOW, "")...)
+	if got := w.events(buf); got != nil {
+		t.Errorf("events after an overflow = %v, want nil", got)
+	}
+	if got := w.events(inotifyEvent(1, unix.IN_IGNORED, "")); got == nil || w.dirs[dir] {
+		t.Errorf("events = %v, dirs = %v after the watch was removed, want none and %s forgotten", got, w.dirs, dir)
+	}
+}
+
+func TestInotifyReadError(t *testing.T) {
+	w := &inotifyWatcher{fd: -1}
+	if _, ok := <-w.changes(); ok {
+		t.Fatal("changes received from a bad descriptor")
+	}
+	if w.err() == nil {
+		t.Error("no error after the channel was closed")
+	}
+}
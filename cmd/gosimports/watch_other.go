@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import "errors"
+
+// newWatcher returns the watcher of the system, if it supports one.
+func newWatcher() (watcher, error) {
+	return nil, errors.New("not supported on this system")
+}
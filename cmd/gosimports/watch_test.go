@@ -0,0 +1,112 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// A fakeWatcher records the directories it is asked to watch.
+type fakeWatcher struct{ dirs []string }
+
+func (w *fakeWatcher) add(dir string) error {
+	w.dirs = append(w.dirs, dir)
+	return nil
+}
+
+func (w *fakeWatcher) changes() <-chan []string { return nil }
+
+func (w *fakeWatcher) err() error { return nil }
+
+func TestCheckEvents(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.go":     "package p\n",
+		"b.go":     "package p\n",
+		"sub/c.go": "package sub\n",
+	})
+	a, b := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	w := &fakeWatcher{}
+	seen, errs := watchScan([]string{dir}, w)
+	if len(errs) > 0 {
+		t.Fatal(errs[0].err)
+	}
+	if want := []string{dir, filepath.Join(dir, "sub")}; !reflect.DeepEqual(w.dirs, want) {
+		t.Errorf("watched %v, want %v", w.dirs, want)
+	}
+
+	// touch changes the file at path, making sure its version differs
+	// whatever the resolution of modification times.
+	n := 0
+	touch := func(path string) {
+		n++
+		if err := os.WriteFile(path, []byte("package p\n"+string(make([]byte, n))), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(time.Duration(n) * time.Second)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(events []string, want ...string) {
+		t.Helper()
+		var got []string
+		for _, job := range checkEvents(seen, events) {
+			got = append(got, job.path)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("checkEvents(%v) = %v, want %v", events, got, want)
+		}
+	}
+
+	// Only the files in the events are checked.
+	touch(a)
+	touch(b)
+	check([]string{a}, a)
+	// A file saved again while it is processed is processed again.
+	touch(a)
+	check([]string{a, a}, a)
+	check([]string{a})
+	check([]string{b}, b)
+	// Files not seen are left to rescans.
+	check([]string{filepath.Join(dir, "new.go")})
+
+	if err := os.Remove(b); err != nil {
+		t.Fatal(err)
+	}
+	check([]string{b})
+	if _, ok := seen[b]; ok {
+		t.Errorf("removed %s still seen", b)
+	}
+}
+
+func TestNeedsRescan(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.go":       "package p\n",
+		"new.go":     "package p\n",
+		".hidden.go": "package p\n",
+		"README":     "",
+		"sub/x.txt":  "",
+	})
+	seen := map[string]fileStamp{filepath.Join(dir, "a.go"): {}}
+	for _, tt := range []struct {
+		name string
+		want bool
+	}{
+		{"a.go", false},
+		{"new.go", true},
+		{".hidden.go", false},
+		{"README", false},
+		{"sub", true},
+		{"gone", false},
+		{".gitignore", true},
+		{".gosimports.toml", true},
+	} {
+		if got := needsRescan([]string{filepath.Join(dir, tt.name)}, seen); got != tt.want {
+			t.Errorf("needsRescan(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// errFileChanged is returned by writeFile when a file was modified by
+// someone else while gosimports was processing it.
+var errFileChanged = errors.New("changed on disk since it was read, not overwriting it")
+
+// writeFile replaces the contents of filename, src when it was read, with
+// res, keeping its previous version if -backup is set.
+//
+// The file is replaced by renaming a temporary file over it, so that it is
+// never left truncated. If filename is a symbolic link, the file it points
+// to is replaced, and the link is kept.
+func writeFile(filename string, src, res []byte) error {
+	path, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return fmt.Errorf("%s: not a regular file", filename)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(current, src) {
+		return fmt.Errorf("%s: %w", filename, errFileChanged)
+	}
+	if *backup != "" {
+		if err := replaceFile(path+*backup, src, fi); err != nil {
+			return err
+		}
+	}
+	return replaceFile(path, res, fi)
+}
+
+// replaceFile replaces the file path, or creates it, with one containing
+// data, with the permissions and owner of the file described by fi.
+//
+// If path has several hard links, or its owner can't be set, it is
+// overwritten in place instead, as renaming another file over it would
+// break the links or change its owner; this is logged with -v.
+func replaceFile(path string, data []byte, fi os.FileInfo) error {
+	// Keep the mode of the file, including on Windows. See golang/go#38225.
+	perm := fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if old, err := os.Lstat(path); err == nil && linkCount(old) > 1 {
+		if verbose {
+			log.Printf("%s: overwriting in place: it has %d hard links", path, linkCount(old))
+		}
+		return os.WriteFile(path, data, perm)
+	}
+
+	// The temporary file is hidden, so that it is skipped when walking
+	// directories.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpName, perm)
+	}
+	if err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := chown(tmpName, fi); err != nil {
+		os.Remove(tmpName)
+		if verbose {
+			log.Printf("%s: overwriting in place: %v", path, err)
+		}
+		return os.WriteFile(path, data, perm)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+// +build !unix
+
+package main
+
+import "os"
+
+// linkCount returns the number of hard links to the file described by fi.
+func linkCount(fi os.FileInfo) uint64 {
+	return 1
+}
+
+// chown sets the owner and group of the file name to those of the file
+// described by fi.
+func chown(name string, fi os.FileInfo) error {
+	return nil
+}
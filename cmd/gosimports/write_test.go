@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureLog redirects the log to a buffer for the duration of the test.
+func captureLog(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	flags := log.Flags()
+	log.SetOutput(&buf)
+	log.SetFlags(0)
+	t.Cleanup(func() {
+		log.SetOutput(os.Stderr)
+		log.SetFlags(flags)
+	})
+	return &buf
+}
+
+// checkFile checks the contents and permissions of the file at path.
+func checkFile(t *testing.T, path, want string, perm os.FileMode) os.FileInfo {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("%s = %q, want %q", path, got, want)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != perm {
+		t.Errorf("%s mode = %v, want %v", path, fi.Mode().Perm(), perm)
+	}
+	return fi
+}
+
+func TestWriteFileRenames(t *testing.T) {
+	setFlag(t, &verbose, true)
+	logs := captureLog(t)
+	path := filepath.Join(t.TempDir(), "a.go")
+	writeFiles(t, filepath.Dir(path), map[string]string{"a.go": "old"})
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFile(path, []byte("old"), []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	after := checkFile(t, path, "new", 0o640)
+	if os.SameFile(before, after) {
+		t.Errorf("%s was overwritten in place, want it replaced", path)
+	}
+	if logs.Len() > 0 {
+		t.Errorf("unexpected log: %s", logs)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("temporary files left: %v", entries)
+	}
+}
+
+func TestWriteFileKeepsPermissions(t *testing.T) {
+	setFlag(t, backup, ".orig")
+	path := filepath.Join(t.TempDir(), "a.go")
+	writeFiles(t, filepath.Dir(path), map[string]string{"a.go": "old"})
+	if err := os.Chmod(path, 0o751); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writeFile(path, []byte("old"), []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, path, "new", 0o751)
+	checkFile(t, path+".orig", "old", 0o751)
+}
+
+func TestWriteFileHardLink(t *testing.T) {
+	setFlag(t, &verbose, true)
+	logs := captureLog(t)
+	dir := t.TempDir()
+	path, link := filepath.Join(dir, "a.go"), filepath.Join(dir, "b.go")
+	writeFiles(t, dir, map[string]string{"a.go": "old"})
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(path, link); err != nil {
+		t.Skip(err)
+	}
+	if fi, err := os.Lstat(path); err != nil {
+		t.Fatal(err)
+	} else if linkCount(fi) == 1 {
+		t.Skip("hard links aren't counted on this system")
+	}
+
+	if err := writeFile(path, []byte("old"), []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	fi := checkFile(t, path, "new", 0o600)
+	if linkFi := checkFile(t, link, "new", 0o600); !os.SameFile(fi, linkFi) {
+		t.Errorf("%s and %s are no longer the same file", path, link)
+	}
+	if !strings.Contains(logs.String(), "a.go: overwriting in place: it has 2 hard links") {
+		t.Errorf("fallback not logged, got %q", logs)
+	}
+}
+
+func TestWriteFileChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.go")
+	writeFiles(t, filepath.Dir(path), map[string]string{"a.go": "edited"})
+	if err := os.Chmod(path, 0o640); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(path, []byte("old"), []byte("new")); err == nil || !strings.Contains(err.Error(), errFileChanged.Error()) {
+		t.Errorf("writeFile = %v, want %v", err, errFileChanged)
+	}
+	checkFile(t, path, "edited", 0o640)
+}
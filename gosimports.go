@@ -21,8 +21,21 @@ type Options struct {
 	TabWidth  int  // Tab width (8 if nil *Options provided)
 
 	FormatOnly bool // Disable the insertion and deletion of imports
+
+	Generated GeneratedPolicy // How to process generated files (GeneratedFull if nil *Options provided)
 }
 
+// GeneratedPolicy controls how Process handles generated files: files with
+// a "// Code generated ... DO NOT EDIT." comment before the package clause,
+// as described at https://go.dev/s/generatedcode.
+type GeneratedPolicy int
+
+const (
+	GeneratedFull       GeneratedPolicy = iota // Process generated files like any other file
+	GeneratedFormatOnly                        // Format generated files without inserting or deleting imports
+	GeneratedSkip                              // Leave generated files unchanged
+)
+
 // Debug controls verbose logging.
 var Debug = false
 
@@ -31,6 +44,13 @@ var Debug = false
 // into another group after 3rd-party packages.
 var LocalPrefix string
 
+// Groups lists the groups Process separates imports into, in order. Each is
+// a space-separated list of the matchers std, default, local, prefix:P,
+// glob:G and regexp:R, and default must appear once. If nil, imports are
+// grouped into the standard library, third-party packages, App Engine
+// packages and local packages.
+var Groups []string
+
 // Process formats and adjusts imports for the provided file.
 // If opt is nil, the defaults are used.
 // If src is nil, the source is read from the filesystem.
@@ -59,12 +79,14 @@ func Process(filename string, src []byte, opt *Options) ([]byte, error) {
 			GocmdRunner: &gocommand.Runner{},
 		},
 		LocalPrefix: LocalPrefix,
+		Groups:      Groups,
 		Fragment:    opt.Fragment,
 		AllErrors:   opt.AllErrors,
 		Comments:    opt.Comments,
 		TabIndent:   opt.TabIndent,
 		TabWidth:    opt.TabWidth,
 		FormatOnly:  opt.FormatOnly,
+		Generated:   imports.GeneratedPolicy(opt.Generated), // the constants match
 	}
 	if Debug {
 		intopt.Env.Logf = log.Printf
@@ -51,3 +51,26 @@ func TestProcess_unknown_filename(t *testing.T) {
 		t.Fatal("expected: err != nil")
 	}
 }
+
+func TestProcess_generated(t *testing.T) {
+	src := []byte("// Code generated by foo. DO NOT EDIT.\n\npackage p\n\nimport \"os\"\n\nvar _ =strings.ToUpper\n")
+
+	tests := []struct {
+		policy gosimports.GeneratedPolicy
+		want   string
+	}{
+		{gosimports.GeneratedFull, "// Code generated by foo. DO NOT EDIT.\n\npackage p\n\nimport \"strings\"\n\nvar _ = strings.ToUpper\n"},
+		{gosimports.GeneratedFormatOnly, "// Code generated by foo. DO NOT EDIT.\n\npackage p\n\nimport \"os\"\n\nvar _ = strings.ToUpper\n"},
+		{gosimports.GeneratedSkip, string(src)},
+	}
+	for _, tt := range tests {
+		opt := &gosimports.Options{Comments: true, TabIndent: true, TabWidth: 8, Generated: tt.policy}
+		formatted, err := gosimports.Process("x.go", src, opt)
+		if err != nil {
+			t.Fatalf("policy %d: %v", tt.policy, err)
+		}
+		if string(formatted) != tt.want {
+			t.Errorf("policy %d: got\n%s\nwant\n%s", tt.policy, formatted, tt.want)
+		}
+	}
+}
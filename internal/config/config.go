@@ -0,0 +1,300 @@
+// Package config reads gosimports configuration files.
+//
+// A configuration file is named .gosimports.toml and applies to files in the
+// directory containing it and all directories below it. Settings from a file
+// in a nested directory override those of the files above it, except that
+// exclusions accumulate. A file containing "root = true" stops the search for
+// files in its parent directories. The aliases of nested files are added to
+// those of the files above them.
+//
+// An example configuration file:
+//
+//	# Put imports of our own packages into a group after third-party ones.
+//	local = ["github.com/ourorg"]
+//
+//	# Separate imports into these groups, in order.
+//	groups = ["std", "default", "prefix:github.com/ourorg/", "local"]
+//
+//	# Put blank and dot imports in groups of their own after the others.
+//	blank_dot_groups = true
+//
+//	# Skip these paths when walking directories.
+//	exclude = ["gen/", "**/*.pb.go"]
+//
+//	# Remove names of imports that are the names of their packages.
+//	remove_redundant_aliases = true
+//
+//	# Name the imports of these paths so.
+//	[aliases]
+//	"k8s.io/api/core/v1" = "corev1"
+//	"k8s.io/apimachinery/pkg/apis/meta/v1" = "metav1"
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// FileName is the name of configuration files.
+const FileName = ".gosimports.toml"
+
+// Config is the configuration applying to a directory.
+type Config struct {
+	// Local lists the import path prefixes placed in the local group,
+	// or is nil if no configuration file sets them.
+	Local []string
+
+	// Groups lists the import groups, as described by
+	// imports.ParseGrouping, or is nil if no configuration file sets them.
+	Groups []string
+
+	// BlankDotGroups reports whether blank and dot imports are put in
+	// groups of their own, or is nil if no configuration file sets it.
+	BlankDotGroups *bool
+
+	// Aliases maps import paths to the names their imports must have,
+	// or is nil if no configuration file sets any.
+	Aliases map[string]string
+
+	// RemoveRedundantAliases reports whether the names of imports that
+	// are the names of their packages are removed, or is nil if no
+	// configuration file sets it.
+	RemoveRedundantAliases *bool
+
+	// Exclude lists the patterns of files and directories to skip when
+	// walking directories.
+	Exclude []Pattern
+
+	// Files lists the configuration files the configuration was read
+	// from, outermost first.
+	Files []string
+}
+
+// Excluded reports whether the file or directory at the absolute path name
+// matches one of c.Exclude.
+func (c *Config) Excluded(name string, isDir bool) bool {
+	for _, p := range c.Exclude {
+		if p.Match(name, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// merge returns the configuration of a directory whose parent's
+// configuration is c, and whose own configuration file sets child.
+func (c *Config) merge(child *file) *Config {
+	if child.root {
+		c = &Config{}
+	}
+	res := &Config{
+		Local:                  c.Local,
+		Groups:                 c.Groups,
+		BlankDotGroups:         c.BlankDotGroups,
+		Aliases:                c.Aliases,
+		RemoveRedundantAliases: c.RemoveRedundantAliases,
+		Exclude:                append(append([]Pattern(nil), c.Exclude...), child.exclude...),
+		Files:                  append(append([]string(nil), c.Files...), child.name),
+	}
+	if child.local != nil {
+		res.Local = child.local
+	}
+	if child.groups != nil {
+		res.Groups = child.groups
+	}
+	if child.blankDotGroups != nil {
+		res.BlankDotGroups = child.blankDotGroups
+	}
+	if child.aliases != nil {
+		res.Aliases = map[string]string{}
+		for path, alias := range c.Aliases {
+			res.Aliases[path] = alias
+		}
+		for path, alias := range child.aliases {
+			res.Aliases[path] = alias
+		}
+	}
+	if child.removeRedundantAliases != nil {
+		res.RemoveRedundantAliases = child.removeRedundantAliases
+	}
+	return res
+}
+
+// A file holds the settings of a single configuration file.
+type file struct {
+	name                   string
+	root                   bool
+	local                  []string
+	groups                 []string
+	exclude                []Pattern
+	blankDotGroups         *bool
+	aliases                map[string]string
+	removeRedundantAliases *bool
+}
+
+func parseFile(filename string, data []byte) (*file, error) {
+	entries, err := parseTOML(filename, data)
+	if err != nil {
+		return nil, err
+	}
+	f := &file{name: filename}
+	dir := filepath.Dir(filename)
+	for _, e := range entries {
+		errorf := func(format string, args ...interface{}) error {
+			return fmt.Errorf("%s:%d: %s", filename, e.line, fmt.Sprintf(format, args...))
+		}
+		switch e.table {
+		case "":
+		case "aliases":
+			alias, ok := e.value.(string)
+			if !ok {
+				return nil, errorf("the alias of %q must be a string", e.key)
+			}
+			if err := imports.CheckAlias(e.key, alias); err != nil {
+				return nil, errorf("%v", err)
+			}
+			if f.aliases == nil {
+				f.aliases = map[string]string{}
+			}
+			f.aliases[e.key] = alias
+			continue
+		default:
+			return nil, errorf("unknown table [%s]", e.table)
+		}
+		switch e.key {
+		case "root":
+			b, ok := e.value.(bool)
+			if !ok {
+				return nil, errorf("root must be a boolean")
+			}
+			f.root = b
+		case "local":
+			switch v := e.value.(type) {
+			case string:
+				f.local = []string{}
+				for _, p := range strings.Split(v, ",") {
+					if p = strings.TrimSpace(p); p != "" {
+						f.local = append(f.local, p)
+					}
+				}
+			case []string:
+				f.local = append([]string{}, v...)
+			default:
+				return nil, errorf("local must be a string or an array of strings")
+			}
+		case "groups":
+			groups, ok := e.value.([]string)
+			if !ok {
+				return nil, errorf("groups must be an array of strings")
+			}
+			if _, err := imports.ParseGrouping(groups, ""); err != nil {
+				return nil, errorf("%v", err)
+			}
+			f.groups = append([]string{}, groups...)
+		case "blank_dot_groups":
+			b, ok := e.value.(bool)
+			if !ok {
+				return nil, errorf("blank_dot_groups must be a boolean")
+			}
+			f.blankDotGroups = &b
+		case "remove_redundant_aliases":
+			b, ok := e.value.(bool)
+			if !ok {
+				return nil, errorf("remove_redundant_aliases must be a boolean")
+			}
+			f.removeRedundantAliases = &b
+		case "exclude":
+			globs, ok := e.value.([]string)
+			if !ok {
+				return nil, errorf("exclude must be an array of strings")
+			}
+			for _, g := range globs {
+				if g == "" {
+					return nil, errorf("empty exclude pattern")
+				}
+				f.exclude = append(f.exclude, Pattern{Dir: dir, Glob: g})
+			}
+		default:
+			return nil, errorf("unknown key %q", e.key)
+		}
+	}
+	return f, nil
+}
+
+// Load reads the configuration file filename on its own, without regard to
+// files in other directories.
+func Load(filename string) (*Config, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return nil, err
+	}
+	f, err := parseFile(abs, data)
+	if err != nil {
+		return nil, err
+	}
+	return (&Config{}).merge(f), nil
+}
+
+// A Finder finds the configuration of directories, caching the result for
+// each directory it visits. It is safe for concurrent use.
+type Finder struct {
+	mu   sync.Mutex
+	dirs map[string]*Config
+}
+
+// Find returns the configuration applying to the directory dir, read from
+// the configuration files in dir and its ancestors.
+func (f *Finder) Find(dir string) (*Config, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.dirs == nil {
+		f.dirs = map[string]*Config{}
+	}
+	return f.find(dir)
+}
+
+func (f *Finder) find(dir string) (*Config, error) {
+	if c, ok := f.dirs[dir]; ok {
+		return c, nil
+	}
+	// The file of dir is read first, so that the files of the parent
+	// directories aren't read at all when it is a root.
+	var own *file
+	name := filepath.Join(dir, FileName)
+	data, err := os.ReadFile(name)
+	switch {
+	case err == nil:
+		if own, err = parseFile(name, data); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	}
+
+	c := &Config{}
+	if p := filepath.Dir(dir); p != dir && (own == nil || !own.root) {
+		if c, err = f.find(p); err != nil {
+			return nil, err
+		}
+	}
+	if own != nil {
+		c = c.merge(own)
+	}
+	f.dirs[dir] = c
+	return c, nil
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTOML(t *testing.T) {
+	const src = `# comment
+root = true
+local = "a.com, b.com" # trailing comment
+list = [
+	"x", # first
+	'y#z',
+]
+n = 1_000
+
+["quoted table"]
+"k8s.io/api/core/v1" = "corev1"
+`
+	got, err := parseTOML("test.toml", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []entry{
+		{key: "root", value: true, line: 2},
+		{key: "local", value: "a.com, b.com", line: 3},
+		{key: "list", value: []string{"x", "y#z"}, line: 4},
+		{key: "n", value: int64(1000), line: 8},
+		{table: "quoted table", key: "k8s.io/api/core/v1", value: "corev1", line: 11},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseTOML() =\n%#v\nwant\n%#v", got, want)
+	}
+}
+
+func TestParseTOMLErrors(t *testing.T) {
+	for _, src := range []string{
+		"key",
+		"key = ",
+		`key = "unterminated`,
+		"key = [1, 2]",
+		`key = ["a" "b"]`,
+		"key = 1\nkey = 2",
+		"[[array]]",
+		`key = "a" "b"`,
+	} {
+		if _, err := parseTOML("test.toml", []byte(src)); err == nil {
+			t.Errorf("parseTOML(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		glob, rel string
+		isDir     bool
+		want      bool
+	}{
+		{"*.pb.go", "a/b/x.pb.go", false, true},
+		{"*.pb.go", "a/b/x.go", false, false},
+		{"gen/", "a/gen", true, true},
+		{"gen/", "a/gen", false, false},
+		{"a/*.go", "a/x.go", false, true},
+		{"a/*.go", "b/a/x.go", false, false},
+		{"/a/*.go", "a/x.go", false, true},
+		{"**/*.go", "x.go", false, true},
+		{"**/*.go", "a/b/x.go", false, true},
+		{"a/**/z", "a/z", true, true},
+		{"a/**/z", "a/b/c/z", true, true},
+		{"a/**/z", "b/z", true, false},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.glob, tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("MatchGlob(%q, %q, %v) = %v, want %v", tt.glob, tt.rel, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestFinder(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("repo/.gosimports.toml", "root = true\nlocal = [\"example.com/repo\"]\nexclude = [\"gen/\"]\n")
+	write("repo/sub/.gosimports.toml", "local = \"example.com/repo/sub,example.com/other\"\nexclude = [\"*_gen.go\"]\n")
+	write("repo/plain/.keep", "")
+	write("repo/sub/deeper/.keep", "")
+
+	var f Finder
+	tests := []struct {
+		dir   string
+		local []string
+		files int
+	}{
+		{"repo", []string{"example.com/repo"}, 1},
+		{"repo/plain", []string{"example.com/repo"}, 1},
+		{"repo/sub", []string{"example.com/repo/sub", "example.com/other"}, 2},
+		{"repo/sub/deeper", []string{"example.com/repo/sub", "example.com/other"}, 2},
+	}
+	for _, tt := range tests {
+		c, err := f.Find(filepath.Join(root, tt.dir))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(c.Local, tt.local) || len(c.Files) != tt.files {
+			t.Errorf("Find(%s) = local %v from %v, want %v from %d files", tt.dir, c.Local, c.Files, tt.local, tt.files)
+		}
+	}
+
+	c, err := f.Find(filepath.Join(root, "repo/sub"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"repo/sub/gen/x.go":    true,
+		"repo/gen/x.go":        true,
+		"repo/sub/x_gen.go":    true,
+		"repo/sub/x.go":        false,
+		"repo/x_gen.go":        false,
+		"repo/sub/generated.x": false,
+	} {
+		if got := c.Excluded(filepath.Join(root, name), false); got != want {
+			t.Errorf("Excluded(%s) = %v, want %v", name, got, want)
+		}
+	}
+
+	write("bad/.gosimports.toml", "unknown = 1\n")
+	if _, err := f.Find(filepath.Join(root, "bad")); err == nil || !strings.Contains(err.Error(), "unknown key") {
+		t.Errorf("Find(bad) = %v, want unknown key error", err)
+	}
+	// The files above a root aren't read.
+	write("bad/root/.gosimports.toml", "root = true\nlocal = [\"example.com/root\"]\n")
+	if c, err := f.Find(filepath.Join(root, "bad/root")); err != nil {
+		t.Errorf("Find(bad/root) = %v, want no error", err)
+	} else if want := []string{"example.com/root"}; !reflect.DeepEqual(c.Local, want) {
+		t.Errorf("Find(bad/root) = local %v, want %v", c.Local, want)
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		name = filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(".git/info/exclude", "local.go\n")
+	write(".gitignore", "# build output\n/bin/\n*.gen.go\n!keep.gen.go\n\\#odd.go\n")
+	write("a/.gitignore", "keep.gen.go\nsub/*.go\n")
+	write("a/sub/.keep", "")
+
+	ig, err := IgnoreFor(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]bool{
+		"bin":               true,
+		"a/bin":             false,
+		"local.go":          true,
+		"a/x.gen.go":        true,
+		"a/keep.gen.go":     true,
+		"a/sub/x.go":        true,
+		"a/sub/deeper/x.go": false,
+		"a/#odd.go":         true,
+		"a/x.go":            false,
+	} {
+		isDir := !strings.HasSuffix(name, ".go")
+		if got := ig.Ignored(filepath.Join(root, name), isDir); got != want {
+			t.Errorf("Ignored(%s) = %v, want %v", name, got, want)
+		}
+	}
+
+	ig, err = IgnoreFor(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ig.Ignored(filepath.Join(root, "keep.gen.go"), false) {
+		t.Errorf("Ignored(keep.gen.go) = true, want false: negated by the root .gitignore")
+	}
+}
+
+func TestGroups(t *testing.T) {
+	f, err := parseFile("/a/.gosimports.toml", []byte(`groups = ["std", "prefix:golang.org/x/", "default", "local"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := (&Config{Groups: []string{"std", "default"}}).merge(f)
+	if want := []string{"std", "prefix:golang.org/x/", "default", "local"}; !reflect.DeepEqual(c.Groups, want) {
+		t.Errorf("Groups = %q, want %q", c.Groups, want)
+	}
+	if c := c.merge(&file{name: "/a/b/.gosimports.toml"}); !reflect.DeepEqual(c.Groups, f.groups) {
+		t.Errorf("Groups = %q, want them inherited", c.Groups)
+	}
+
+	f, err = parseFile("/a/b/.gosimports.toml", []byte("blank_dot_groups = true"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := c.merge(f); c.BlankDotGroups == nil || !*c.BlankDotGroups || c.Groups == nil {
+		t.Errorf("BlankDotGroups = %v with groups %q, want true and inherited groups", c.BlankDotGroups, c.Groups)
+	}
+
+	for _, src := range []string{
+		`groups = "std"`,
+		`blank_dot_groups = "yes"`,
+		`groups = ["std"]`,
+		`groups = ["default", "prefix:"]`,
+	} {
+		if _, err := parseFile("/a/.gosimports.toml", []byte(src)); err == nil {
+			t.Errorf("parseFile(%q) succeeded, want error", src)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	f, err := parseFile("/a/.gosimports.toml", []byte(`remove_redundant_aliases = true
+
+[aliases]
+"k8s.io/api/core/v1" = "corev1"
+"k8s.io/apimachinery/pkg/apis/meta/v1" = "metav1"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := (&Config{}).merge(f)
+	if c.RemoveRedundantAliases == nil || !*c.RemoveRedundantAliases {
+		t.Errorf("RemoveRedundantAliases = %v, want true", c.RemoveRedundantAliases)
+	}
+
+	f, err = parseFile("/a/b/.gosimports.toml", []byte(`[aliases]
+"k8s.io/api/core/v1" = "v1"
+"k8s.io/api/apps/v1" = "appsv1"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"k8s.io/api/core/v1":                   "v1",
+		"k8s.io/api/apps/v1":                   "appsv1",
+		"k8s.io/apimachinery/pkg/apis/meta/v1": "metav1",
+	}
+	if c := c.merge(f); !reflect.DeepEqual(c.Aliases, want) {
+		t.Errorf("Aliases = %v, want %v", c.Aliases, want)
+	}
+	if len(c.Aliases) != 2 {
+		t.Errorf("merging changed the aliases of the parent: %v", c.Aliases)
+	}
+
+	for _, src := range []string{
+		"remove_redundant_aliases = 1",
+		"[aliases]\n\"k8s.io/api/core/v1\" = true",
+		"[aliases]\n\"k8s.io/api/core/v1\" = \"core-v1\"",
+		"[aliases]\n\"k8s.io/api/core/v1\" = \"_\"",
+		"[alias]\n\"k8s.io/api/core/v1\" = \"corev1\"",
+	} {
+		if _, err := parseFile("/a/.gosimports.toml", []byte(src)); err == nil {
+			t.Errorf("parseFile(%q) succeeded, want error", src)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IgnoreFileName is the name of the files listing the files git ignores.
+const IgnoreFileName = ".gitignore"
+
+// An Ignore holds the rules of the .gitignore files applying to a
+// directory. A nil *Ignore has no rules.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	Pattern
+	negate bool
+}
+
+// Ignored reports whether the file or directory at the absolute path name
+// is ignored: whether the last rule matching it is not a negated one.
+// Unlike git, Ignored does not consider whether a parent directory of name
+// is ignored; callers walking a tree are expected to skip such directories.
+func (ig *Ignore) Ignored(name string, isDir bool) bool {
+	if ig == nil {
+		return false
+	}
+	for i := len(ig.rules) - 1; i >= 0; i-- {
+		r := ig.rules[i]
+		if rel, ok := relSlash(r.Dir, name); ok && MatchGlob(r.Glob, rel, isDir) {
+			return !r.negate
+		}
+	}
+	return false
+}
+
+// ReadDir returns ig extended by the rules of the .gitignore file in the
+// directory dir, which take precedence over those of ig. It returns ig
+// itself if there is no such file.
+func (ig *Ignore) ReadDir(dir string) (*Ignore, error) {
+	return ig.read(dir, filepath.Join(dir, IgnoreFileName))
+}
+
+func (ig *Ignore) read(dir, filename string) (*Ignore, error) {
+	data, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return ig, nil
+	} else if err != nil {
+		return nil, err
+	}
+	rules := parseIgnore(dir, data)
+	if len(rules) == 0 {
+		return ig, nil
+	}
+	var res Ignore
+	if ig != nil {
+		res.rules = append(res.rules, ig.rules...)
+	}
+	res.rules = append(res.rules, rules...)
+	return &res, nil
+}
+
+// IgnoreFor returns the rules applying to the directory dir, read from the
+// .gitignore files in it and its parents up to the root of the git working
+// tree containing it, and from the repository's info/exclude file. If dir is
+// not in a working tree, only its own .gitignore file is read.
+func IgnoreFor(dir string) (*Ignore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	// Collect the directories up to the root of the working tree.
+	var dirs []string
+	top := ""
+	for d := dir; ; {
+		dirs = append(dirs, d)
+		if _, err := os.Stat(filepath.Join(d, ".git")); err == nil {
+			top = d
+			break
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			break
+		}
+		d = parent
+	}
+
+	var ig *Ignore
+	if top == "" {
+		return ig.ReadDir(dir)
+	}
+	if isGitDir(filepath.Join(top, ".git")) {
+		if ig, err = ig.read(top, filepath.Join(top, ".git", "info", "exclude")); err != nil {
+			return nil, err
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if ig, err = ig.ReadDir(dirs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return ig, nil
+}
+
+func isGitDir(name string) bool {
+	fi, err := os.Stat(name)
+	return err == nil && fi.IsDir()
+}
+
+// parseIgnore parses the rules of a .gitignore file in the directory dir.
+func parseIgnore(dir string, data []byte) []ignoreRule {
+	var rules []ignoreRule
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// Trailing spaces are ignored unless escaped.
+		for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+			line = line[:len(line)-1]
+		}
+		var r ignoreRule
+		if strings.HasPrefix(line, "!") {
+			r.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+			line = line[1:]
+		}
+		if line == "" || line == "/" {
+			continue
+		}
+		r.Pattern = Pattern{Dir: dir, Glob: line}
+		rules = append(rules, r)
+	}
+	return rules
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A Pattern is a glob matched against slash-separated paths relative to Dir.
+//
+// Patterns follow .gitignore conventions: a pattern containing a slash
+// (other than a trailing one) is matched against the whole relative path,
+// and otherwise against the name of any file or directory in it. A leading
+// slash only anchors the pattern, and a trailing slash makes it match
+// directories only. In addition to the wildcards of path.Match, a "**"
+// element matches any number of directories.
+type Pattern struct {
+	Dir  string // absolute directory the pattern is relative to
+	Glob string
+}
+
+// Match reports whether the file or directory at the absolute path name
+// matches p, or is inside a directory that does.
+func (p Pattern) Match(name string, isDir bool) bool {
+	rel, ok := relSlash(p.Dir, name)
+	if !ok {
+		return false
+	}
+	elems := strings.Split(rel, "/")
+	for i := range elems {
+		// Ancestors of name are always directories.
+		if MatchGlob(p.Glob, strings.Join(elems[:i+1], "/"), isDir || i < len(elems)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchGlob reports whether the slash-separated relative path rel, naming a
+// directory if isDir is set, matches glob itself, following the conventions
+// described for Pattern.
+func MatchGlob(glob, rel string, isDir bool) bool {
+	if strings.HasSuffix(glob, "/") {
+		if !isDir {
+			return false
+		}
+		glob = strings.TrimSuffix(glob, "/")
+	}
+	if !strings.Contains(glob, "/") {
+		ok, _ := path.Match(glob, path.Base(rel))
+		return ok
+	}
+	glob = strings.TrimPrefix(glob, "/")
+	return matchElems(strings.Split(glob, "/"), strings.Split(rel, "/"))
+}
+
+func matchElems(glob, elems []string) bool {
+	for len(glob) > 0 {
+		if glob[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchElems(glob[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(glob[0], elems[0]); !ok {
+			return false
+		}
+		glob, elems = glob[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// relSlash returns name relative to dir, using slashes, if it is inside dir.
+func relSlash(dir, name string) (string, bool) {
+	dir = strings.TrimSuffix(path.Clean(filepath.ToSlash(dir)), "/")
+	name = path.Clean(filepath.ToSlash(name))
+	if !strings.HasPrefix(name, dir+"/") {
+		return "", false
+	}
+	return name[len(dir)+1:], true
+}
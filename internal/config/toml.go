@@ -0,0 +1,215 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// An entry is a key/value pair read from a configuration file.
+type entry struct {
+	table string      // name of the enclosing [table], or "" at top level
+	key   string      // key, unquoted
+	value interface{} // string, bool, int64 or []string
+	line  int
+}
+
+// parseTOML parses the subset of TOML used by configuration files:
+// comments, [tables], and keys (bare or quoted) whose values are strings,
+// booleans, integers or arrays of strings, which may span multiple lines.
+func parseTOML(filename string, data []byte) ([]entry, error) {
+	var entries []entry
+	table := ""
+	seen := map[string]bool{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	lineNum := 0
+	errorf := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%s:%d: %s", filename, lineNum, fmt.Sprintf(format, args...))
+	}
+	for sc.Scan() {
+		lineNum++
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, errorf("invalid table header %q", line)
+			}
+			name, rest, err := parseKey(strings.TrimSpace(line[1 : len(line)-1]))
+			if err != nil || rest != "" {
+				return nil, errorf("invalid table header %q", line)
+			}
+			table = name
+			continue
+		}
+
+		key, rest, err := parseKey(line)
+		if err != nil {
+			return nil, errorf("%v", err)
+		}
+		if !strings.HasPrefix(rest, "=") {
+			return nil, errorf("expected = after key %q", key)
+		}
+		rest = strings.TrimSpace(rest[1:])
+		entryLine := lineNum
+		// Arrays may continue onto the following lines.
+		if strings.HasPrefix(rest, "[") {
+			for !arrayClosed(rest) && sc.Scan() {
+				lineNum++
+				rest += " " + strings.TrimSpace(stripComment(sc.Text()))
+			}
+		}
+		value, rest, err := parseValue(rest)
+		if err != nil {
+			return nil, errorf("%s: %v", key, err)
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, errorf("%s: unexpected %q after value", key, rest)
+		}
+		full := table + "\x00" + key
+		if seen[full] {
+			return nil, errorf("duplicate key %q", key)
+		}
+		seen[full] = true
+		entries = append(entries, entry{table: table, key: key, value: value, line: entryLine})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// stripComment removes a trailing # comment from line, if it is not
+// inside a string.
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// arrayClosed reports whether s, which starts an array, contains its closing
+// bracket outside of strings.
+func arrayClosed(s string) bool {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ']':
+			return true
+		}
+	}
+	return false
+}
+
+// parseKey parses a bare or quoted key at the start of s, and returns it and
+// the remainder of s with leading space removed.
+func parseKey(s string) (key, rest string, err error) {
+	if s != "" && (s[0] == '"' || s[0] == '\'') {
+		key, rest, err = parseString(s)
+		return key, strings.TrimSpace(rest), err
+	}
+	i := 0
+	for i < len(s) && isBareKeyChar(s[i]) {
+		i++
+	}
+	if i == 0 {
+		return "", "", fmt.Errorf("invalid key in %q", s)
+	}
+	return s[:i], strings.TrimSpace(s[i:]), nil
+}
+
+func isBareKeyChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-'
+}
+
+// parseValue parses the value at the start of s and returns the remainder.
+func parseValue(s string) (interface{}, string, error) {
+	switch {
+	case s == "":
+		return nil, "", fmt.Errorf("missing value")
+	case s[0] == '"' || s[0] == '\'':
+		return parseString(s)
+	case s[0] == '[':
+		var list []string
+		rest := strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(rest, "]") {
+			if rest == "" {
+				return nil, "", fmt.Errorf("unterminated array")
+			}
+			elem, r, err := parseString(rest)
+			if err != nil {
+				return nil, "", fmt.Errorf("arrays may only contain strings: %v", err)
+			}
+			list = append(list, elem)
+			rest = strings.TrimSpace(r)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, "", fmt.Errorf("expected , or ] in array")
+			}
+		}
+		return list, rest[1:], nil
+	case strings.HasPrefix(s, "true"):
+		return true, s[len("true"):], nil
+	case strings.HasPrefix(s, "false"):
+		return false, s[len("false"):], nil
+	}
+	i := 0
+	for i < len(s) && (s[i] == '-' || s[i] == '+' || s[i] == '_' || '0' <= s[i] && s[i] <= '9') {
+		i++
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(s[:i], "_", ""), 10, 64)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid value %q", s)
+	}
+	return n, s[i:], nil
+}
+
+// parseString parses the basic ("...") or literal ('...') string at the start
+// of s and returns it and the remainder of s.
+func parseString(s string) (string, string, error) {
+	if s == "" || (s[0] != '"' && s[0] != '\'') {
+		return "", "", fmt.Errorf("expected string, found %q", s)
+	}
+	if s[0] == '\'' {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string %s", s)
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			str, err := strconv.Unquote(s[:i+1])
+			if err != nil {
+				return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+			}
+			return str, s[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %s", s)
+}
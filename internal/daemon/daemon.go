@@ -0,0 +1,449 @@
+// Package daemon implements a long-running gosimports process that fixes
+// imports on behalf of command line invocations, so that what it learns
+// about each module, such as the output of "go env" and "go list -m" and
+// the packages found by scanning the module cache, survives between them.
+//
+// Clients connect to a Unix socket and send one JSON-encoded Request per
+// connection, to which the daemon replies with a JSON-encoded Response.
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rinchsan/gosimports/internal/gocommand"
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// protocolVersion is incremented whenever Request or Response change, so
+// that clients and daemons of different versions don't misunderstand each
+// other.
+const protocolVersion = 5
+
+// DefaultSocket returns the default path of the daemon's socket, in a
+// directory private to the current user: $XDG_RUNTIME_DIR if set, or a
+// directory of its own in the temporary directory, which Listen creates.
+func DefaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "gosimports.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gosimports-%d", os.Getuid()), "daemon.sock")
+}
+
+// CheckSocket returns an error unless socket is a Unix socket that only the
+// current user can use, which a daemon started by someone else can't have
+// created.
+func CheckSocket(socket string) error {
+	fi, err := os.Lstat(socket)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fi.Mode().Type() != os.ModeSocket:
+		return fmt.Errorf("%s is not a socket", socket)
+	case !ownedByUser(fi):
+		return fmt.Errorf("%s is owned by another user", socket)
+	case fi.Mode().Perm()&0o077 != 0:
+		return fmt.Errorf("%s is accessible to other users", socket)
+	}
+	return nil
+}
+
+// Listen listens on socket, replacing the socket of a daemon that didn't
+// exit cleanly. The directory of socket is created private to the current
+// user if it doesn't exist, and must not be writable by other users, who
+// could replace the socket otherwise.
+func Listen(socket string) (net.Listener, error) {
+	dir := filepath.Dir(socket)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() || !ownedByUser(fi) || fi.Mode().Perm()&0o022 != 0 {
+		return nil, fmt.Errorf("%s must be a directory of the current user not writable by others", dir)
+	}
+	switch err := CheckSocket(socket); {
+	case err == nil:
+		if err := os.Remove(socket); err != nil {
+			return nil, err
+		}
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, fmt.Errorf("not replacing %s: %v", socket, err)
+	}
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socket, 0o600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// A Request asks the daemon to process a file as imports.ProcessFixes does.
+type Request struct {
+	Version int
+
+	// Dir is the working directory of the client, and Env the variables of
+	// its environment affecting the go command.
+	Dir string
+	Env []string
+
+	Filename string // absolute
+	Src      []byte
+	Options  Options
+}
+
+// Options are the imports.Options of a Request, except for Env.
+type Options struct {
+	LocalPrefix            string
+	Groups                 []string
+	BlankDotGroups         bool
+	Aliases                map[string]string
+	RemoveRedundantAliases bool
+	Fragment               bool
+	AllErrors              bool
+	Comments               bool
+	TabIndent              bool
+	TabWidth               int
+	FormatOnly             bool
+	Generated              imports.GeneratedPolicy
+	Overlay                map[string][]byte
+}
+
+// NewOptions returns the Options of opt.
+func NewOptions(opt *imports.Options) Options {
+	return Options{
+		LocalPrefix:            opt.LocalPrefix,
+		Groups:                 opt.Groups,
+		BlankDotGroups:         opt.BlankDotGroups,
+		Aliases:                opt.Aliases,
+		RemoveRedundantAliases: opt.RemoveRedundantAliases,
+		Fragment:               opt.Fragment,
+		AllErrors:              opt.AllErrors,
+		Comments:               opt.Comments,
+		TabIndent:              opt.TabIndent,
+		TabWidth:               opt.TabWidth,
+		FormatOnly:             opt.FormatOnly,
+		Generated:              opt.Generated,
+		Overlay:                opt.Overlay,
+	}
+}
+
+// A Response is the result of a Request.
+type Response struct {
+	Result []byte
+	Fixes  []*imports.ImportFix
+
+	// Error is the error processing the file, if any. If it was a list of
+	// syntax errors, they are in ErrorList.
+	Error     string
+	ErrorList scanner.ErrorList
+}
+
+// Err returns the error processing the file, if any.
+func (r *Response) Err() error {
+	switch {
+	case len(r.ErrorList) > 0:
+		return r.ErrorList
+	case r.Error != "":
+		return errors.New(r.Error)
+	}
+	return nil
+}
+
+// GoEnv returns the variables of environ, a list of key=value pairs,
+// that affect the go command, sorted.
+func GoEnv(environ []string) []string {
+	var env []string
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, "GO") || strings.HasPrefix(kv, "CGO_") {
+			env = append(env, kv)
+		}
+	}
+	sort.Strings(env)
+	return env
+}
+
+// Ping reports whether a daemon of the current user is listening on socket.
+func Ping(socket string) bool {
+	if CheckSocket(socket) != nil {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Process sends req to the daemon listening on socket and returns its
+// response. It only fails if the daemon can't be reached or doesn't
+// understand req, in which case the file should be processed locally.
+func Process(socket string, req *Request) (*Response, error) {
+	if err := CheckSocket(socket); err != nil {
+		return nil, err
+	}
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	req.Version = protocolVersion
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Response
+		Unsupported bool
+	}
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	}
+	if resp.Unsupported {
+		return nil, errors.New("the daemon runs a different version of gosimports")
+	}
+	return &resp.Response, nil
+}
+
+// A Server processes the requests of clients.
+type Server struct {
+	GocmdRunner *gocommand.Runner
+
+	// If Logf is non-nil, requests are logged through it, and so is
+	// debugging information of the environments of modules.
+	Logf func(format string, args ...interface{})
+
+	mu   sync.Mutex
+	envs map[string]*moduleEnv // by module root and go environment
+}
+
+// Serve accepts connections on l until it is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	var req Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		s.logf("reading request: %v", err)
+		return
+	}
+	var resp interface{}
+	if req.Version != protocolVersion {
+		resp = struct{ Unsupported bool }{true}
+	} else {
+		resp = s.process(&req)
+	}
+	if err := json.NewEncoder(conn).Encode(resp); err != nil {
+		s.logf("writing response: %v", err)
+	}
+}
+
+func (s *Server) process(req *Request) *Response {
+	start := time.Now()
+	resp := &Response{}
+	m := s.moduleEnv(req)
+	release := m.acquire()
+	defer release()
+
+	opt := &imports.Options{
+		Env:                    m.env,
+		LocalPrefix:            req.Options.LocalPrefix,
+		Groups:                 req.Options.Groups,
+		BlankDotGroups:         req.Options.BlankDotGroups,
+		Aliases:                req.Options.Aliases,
+		RemoveRedundantAliases: req.Options.RemoveRedundantAliases,
+		Fragment:               req.Options.Fragment,
+		AllErrors:              req.Options.AllErrors,
+		Comments:               req.Options.Comments,
+		TabIndent:              req.Options.TabIndent,
+		TabWidth:               req.Options.TabWidth,
+		FormatOnly:             req.Options.FormatOnly,
+		Generated:              req.Options.Generated,
+		Overlay:                req.Options.Overlay,
+	}
+	var err error
+	resp.Result, resp.Fixes, err = imports.ProcessFixes(req.Filename, req.Src, opt)
+	if list, ok := err.(scanner.ErrorList); ok {
+		resp.ErrorList = list
+	} else if err != nil {
+		resp.Error = err.Error()
+	}
+	s.logf("%s: processed in %v", req.Filename, time.Since(start))
+	return resp
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// moduleEnv returns the environment of the module of the client of req,
+// creating it if there is none or the go.work file in use has changed.
+func (s *Server) moduleEnv(req *Request) *moduleEnv {
+	root, work := moduleRoot(req.Dir), workFile(req.Dir, req.Env)
+	key := strings.Join(append([]string{root}, req.Env...), "\x00")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if m := s.envs[key]; m != nil && m.work == work {
+		return m
+	}
+	if s.envs == nil {
+		s.envs = map[string]*moduleEnv{}
+	}
+	m := &moduleEnv{
+		server:    s,
+		root:      root,
+		goenv:     req.Env,
+		work:      work,
+		modStamp:  stampOf(filepath.Join(root, "go.mod")),
+		workStamp: stampOf(work),
+	}
+	m.reset()
+	s.envs[key] = m
+	s.logf("%s: new environment", root)
+	return m
+}
+
+// A moduleEnv is the environment shared by the requests of the clients
+// working in a module, kept until its go.mod or go.work file changes.
+type moduleEnv struct {
+	server *Server
+	root   string   // the module root, or the client's directory
+	goenv  []string // the environment of the go command
+	work   string   // the go.work file in use, if any
+
+	// mu is held for reading while processing files, and for writing while
+	// updating the fields below.
+	mu        sync.RWMutex
+	env       *imports.ProcessEnv
+	modStamp  stamp
+	workStamp stamp
+}
+
+// reset replaces the environment of m with a new one.
+func (m *moduleEnv) reset() {
+	m.env = &imports.ProcessEnv{
+		GocmdRunner: m.server.GocmdRunner,
+		WorkingDir:  m.root,
+		Env:         map[string]string{},
+		Logf:        m.server.Logf,
+	}
+	for _, kv := range m.goenv {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			m.env.Env[k] = v
+		}
+	}
+}
+
+// acquire makes sure that the resolver of m knows about the current
+// contents of the go.mod and go.work files, and returns a function that
+// must be called when done using m.env.
+func (m *moduleEnv) acquire() (release func()) {
+	mod, work := stampOf(filepath.Join(m.root, "go.mod")), stampOf(m.work)
+	m.mu.RLock()
+	if mod == m.modStamp && work == m.workStamp {
+		return m.mu.RUnlock
+	}
+	m.mu.RUnlock()
+
+	m.mu.Lock()
+	if mod != m.modStamp || work != m.workStamp {
+		if mod.exists != m.modStamp.exists {
+			// The go command now sees a different main module, or
+			// none: start over.
+			m.reset()
+		} else if r, err := m.env.GetResolver(); err == nil {
+			if r, ok := r.(*imports.ModuleResolver); ok {
+				r.ClearForNewMod()
+			}
+		}
+		m.modStamp, m.workStamp = mod, work
+	}
+	m.mu.Unlock()
+	m.mu.RLock()
+	return m.mu.RUnlock
+}
+
+// A stamp identifies a version of a file.
+type stamp struct {
+	exists  bool
+	size    int64
+	modTime int64
+}
+
+func stampOf(filename string) stamp {
+	if filename == "" {
+		return stamp{}
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return stamp{}
+	}
+	return stamp{exists: true, size: fi.Size(), modTime: fi.ModTime().UnixNano()}
+}
+
+// moduleRoot returns the directory of the go.mod file applying to dir, or
+// dir if there is none.
+func moduleRoot(dir string) string {
+	for d := dir; ; {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return dir
+		}
+		d = parent
+	}
+}
+
+// workFile returns the go.work file used by the go command in dir, with
+// the environment env, or "" if there is none.
+func workFile(dir string, env []string) string {
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, "GOWORK="); ok && v != "" {
+			if v == "off" {
+				return ""
+			}
+			return v
+		}
+	}
+	for d := dir; ; {
+		if f := filepath.Join(d, "go.work"); stampOf(f).exists {
+			return f
+		}
+		parent := filepath.Dir(d)
+		if parent == d {
+			return ""
+		}
+		d = parent
+	}
+}
@@ -0,0 +1,225 @@
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rinchsan/gosimports/internal/gocommand"
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) {
+		t.Helper()
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/a\n\ngo 1.20\n")
+	write("foo/foo.go", "package foo\n\nfunc X() {}\n")
+	write("main.go", "package main\n")
+
+	socket := filepath.Join(dir, "d.sock")
+	l, err := Listen(socket)
+	if err != nil {
+		t.Skipf("can't listen on a Unix socket: %v", err)
+	}
+	s := &Server{GocmdRunner: &gocommand.Runner{}}
+	done := make(chan error)
+	go func() { done <- s.Serve(l) }()
+	defer func() {
+		l.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	}()
+
+	if !Ping(socket) {
+		t.Fatal("Ping failed while the daemon is running")
+	}
+
+	process := func(src string) string {
+		t.Helper()
+		resp, err := Process(socket, &Request{
+			Dir:      dir,
+			Env:      GoEnv(append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off")),
+			Filename: filepath.Join(dir, "main.go"),
+			Src:      []byte(src),
+			Options:  NewOptions(&imports.Options{Comments: true, TabIndent: true, TabWidth: 8}),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := resp.Err(); err != nil {
+			t.Fatal(err)
+		}
+		return string(resp.Result)
+	}
+
+	const src = "package main\n\nfunc main() { foo.X() }\n"
+	if got := process(src); !strings.Contains(got, `"example.com/a/foo"`) {
+		t.Errorf("got:\n%s\nwant an import of example.com/a/foo", got)
+	}
+
+	// Renaming the module must be noticed, even though the daemon keeps
+	// what it learned about it.
+	write("go.mod", "module example.com/bb\n\ngo 1.20\n")
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "go.mod"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if got := process(src); !strings.Contains(got, `"example.com/bb/foo"`) {
+		t.Errorf("after changing go.mod, got:\n%s\nwant an import of example.com/bb/foo", got)
+	}
+
+	resp, err := Process(socket, &Request{Dir: dir, Filename: filepath.Join(dir, "main.go"), Src: []byte("package main\nfunc (\n")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.ErrorList) == 0 || resp.ErrorList[0].Pos.Line != 2 {
+		t.Errorf("got error %v, want syntax errors on line 2", resp.Err())
+	}
+}
+
+func TestWorkFile(t *testing.T) {
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if got := workFile(sub, nil); got != "" {
+		t.Errorf("workFile without go.work = %q, want none", got)
+	}
+	work := filepath.Join(dir, "go.work")
+	if err := os.WriteFile(work, []byte("go 1.20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if got := workFile(sub, nil); got != work {
+		t.Errorf("workFile = %q, want %q", got, work)
+	}
+	if got := workFile(sub, []string{"GOWORK=off"}); got != "" {
+		t.Errorf("workFile with GOWORK=off = %q, want none", got)
+	}
+}
+
+func TestDefaultSocket(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")
+	if got, want := DefaultSocket(), filepath.FromSlash("/run/user/1000/gosimports.sock"); got != want {
+		t.Errorf("DefaultSocket() = %q, want %q", got, want)
+	}
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	if got := DefaultSocket(); filepath.Dir(filepath.Dir(got)) != filepath.Clean(os.TempDir()) {
+		t.Errorf("DefaultSocket() = %q, want a directory of its own in %s", got, os.TempDir())
+	}
+}
+
+func TestListen(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "private", "d.sock")
+	l, err := Listen(socket)
+	if err != nil {
+		t.Skipf("can't listen on a Unix socket: %v", err)
+	}
+	fi, err := os.Stat(filepath.Dir(socket))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Mode().Perm(); perm != 0o700 {
+		t.Errorf("socket directory created with mode %v, want 0700", perm)
+	}
+	if err := CheckSocket(socket); err != nil {
+		t.Errorf("CheckSocket of the socket listened on: %v", err)
+	}
+	if !Ping(socket) {
+		t.Error("Ping failed while listening")
+	}
+
+	// The socket of a daemon that didn't exit cleanly, left behind, is
+	// replaced.
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	if l, err = Listen(socket); err != nil {
+		t.Fatalf("Listen on a stale socket: %v", err)
+	}
+	l.Close()
+
+	// Other files are never removed.
+	file := filepath.Join(dir, "private", "file")
+	if err := os.WriteFile(file, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(file); err == nil {
+		t.Error("Listen replaced a regular file")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("Listen removed a regular file: %v", err)
+	}
+
+	// Nor are sockets in directories others can write to used.
+	shared := filepath.Join(dir, "shared")
+	if err := os.Mkdir(shared, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(shared, 0o777); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Listen(filepath.Join(shared, "d.sock")); err == nil {
+		t.Error("Listen succeeded in a directory writable by others")
+	}
+}
+
+func TestCheckSocket(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "d.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("can't listen on a Unix socket: %v", err)
+	}
+	defer l.Close()
+
+	if err := os.Chmod(socket, 0o666); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSocket(socket); err == nil {
+		t.Error("CheckSocket accepted a socket accessible to other users")
+	}
+	if Ping(socket) {
+		t.Error("Ping succeeded on a socket accessible to other users")
+	}
+	if _, err := Process(socket, &Request{}); err == nil {
+		t.Error("Process succeeded on a socket accessible to other users")
+	}
+
+	if err := os.Chmod(socket, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSocket(socket); err != nil {
+		t.Errorf("CheckSocket: %v", err)
+	}
+	if os.Getuid() == 0 {
+		// Only root can give the socket to another user.
+		if err := os.Lchown(socket, 12345, 12345); err != nil {
+			t.Fatal(err)
+		}
+		if err := CheckSocket(socket); err == nil {
+			t.Error("CheckSocket accepted a socket of another user")
+		}
+	}
+
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckSocket(file); err == nil {
+		t.Error("CheckSocket accepted a regular file")
+	}
+}
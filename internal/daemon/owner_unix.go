@@ -0,0 +1,16 @@
+//go:build unix
+// +build unix
+
+package daemon
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByUser reports whether the file described by fi belongs to the
+// current user.
+func ownedByUser(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid()
+}
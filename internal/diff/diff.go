@@ -0,0 +1,318 @@
+// Package diff computes line-based differences between two texts
+// and formats them as unified diffs, without running an external diff program.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// An Edit replaces the lines [OldStart, OldEnd) of the old text
+// with the lines [NewStart, NewEnd) of the new text.
+// Line numbers are zero-based.
+type Edit struct {
+	OldStart, OldEnd int
+	NewStart, NewEnd int
+}
+
+// SplitLines splits text into lines, each of which keeps its trailing newline.
+// The last line has no newline if text does not end with one.
+func SplitLines(text []byte) [][]byte {
+	var lines [][]byte
+	for len(text) > 0 {
+		i := bytes.IndexByte(text, '\n')
+		if i < 0 {
+			lines = append(lines, text)
+			break
+		}
+		lines = append(lines, text[:i+1])
+		text = text[i+1:]
+	}
+	return lines
+}
+
+// Edits returns the edits that turn old into new, in order.
+// The edits form a minimal line-based edit script, as computed by
+// Myers' O(ND) difference algorithm in its linear space variant.
+func Edits(old, new []byte) []Edit {
+	return lineEdits(SplitLines(old), SplitLines(new))
+}
+
+func lineEdits(oldLines, newLines [][]byte) []Edit {
+	// Compare lines by number rather than content.
+	ids := map[string]int{}
+	id := func(lines [][]byte) []int {
+		s := make([]int, len(lines))
+		for i, l := range lines {
+			n, ok := ids[string(l)]
+			if !ok {
+				n = len(ids)
+				ids[string(l)] = n
+			}
+			s[i] = n
+		}
+		return s
+	}
+	d := &differ{a: id(oldLines), b: id(newLines)}
+	d.compare(0, len(d.a), 0, len(d.b))
+
+	// Coalesce the runs of deleted and inserted lines into edits.
+	var edits []Edit
+	i, j := 0, 0
+	for _, op := range d.ops {
+		if op.kind == opEqual {
+			i, j = op.i+1, op.j+1
+			continue
+		}
+		if n := len(edits); n == 0 || edits[n-1].OldEnd != i || edits[n-1].NewEnd != j {
+			edits = append(edits, Edit{OldStart: i, OldEnd: i, NewStart: j, NewEnd: j})
+		}
+		e := &edits[len(edits)-1]
+		if op.kind == opDelete {
+			i = op.i + 1
+			e.OldEnd = i
+		} else {
+			j = op.j + 1
+			e.NewEnd = j
+		}
+	}
+	return edits
+}
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// An op is a single step of the edit script: a[i] is kept as b[j],
+// a[i] is deleted, or b[j] is inserted.
+type op struct {
+	kind opKind
+	i, j int
+}
+
+type differ struct {
+	a, b []int
+	ops  []op
+}
+
+// compare appends to d.ops the edit script that turns a[a0:a1] into b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.ops = append(d.ops, op{opEqual, a0, b0})
+		a0++
+		b0++
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-1-suffix] == d.b[b1-1-suffix] {
+		suffix++
+	}
+	a1 -= suffix
+	b1 -= suffix
+
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.ops = append(d.ops, op{opInsert, a0, j})
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.ops = append(d.ops, op{opDelete, i, b0})
+		}
+	default:
+		// Both sides are non-empty and differ at both ends, so the split
+		// point is strictly inside the edit graph and the recursion
+		// makes progress.
+		x, y := bisect(d.a[a0:a1], d.b[b0:b1])
+		d.compare(a0, a0+x, b0, b0+y)
+		d.compare(a0+x, a1, b0+y, b1)
+	}
+
+	for k := 0; k < suffix; k++ {
+		d.ops = append(d.ops, op{opEqual, a1 + k, b1 + k})
+	}
+}
+
+// bisect finds the middle snake of the edit graph of a and b, searching
+// forward from the start and backward from the end at the same time, and
+// returns a point on an optimal edit path through it.
+func bisect(a, b []int) (x, y int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	vf := make([]int, 2*offset+1) // furthest x reached forward, by diagonal
+	vb := make([]int, 2*offset+1) // furthest distance from the end reached backward
+	for i := range vf {
+		vf[i], vb[i] = -1, -1
+	}
+	vf[offset+1], vb[offset+1] = 0, 0
+
+	delta := n - m
+	// If delta is odd, the forward path is checked for overlap with the
+	// backward one; otherwise, the backward path is checked.
+	front := delta%2 != 0
+	var kfStart, kfEnd, kbStart, kbEnd int
+	for d := 0; d < maxD; d++ {
+		for k := -d + kfStart; k <= d-kfEnd; k += 2 {
+			ki := offset + k
+			var x int
+			if k == -d || (k != d && vf[ki-1] < vf[ki+1]) {
+				x = vf[ki+1]
+			} else {
+				x = vf[ki-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			vf[ki] = x
+			switch {
+			case x > n:
+				kfEnd += 2 // ran off the right of the graph
+			case y > m:
+				kfStart += 2 // ran off the bottom of the graph
+			case front:
+				if bi := offset + delta - k; bi >= 0 && bi < len(vb) && vb[bi] != -1 {
+					if x >= n-vb[bi] {
+						return x, y
+					}
+				}
+			}
+		}
+		for k := -d + kbStart; k <= d-kbEnd; k += 2 {
+			ki := offset + k
+			var x int
+			if k == -d || (k != d && vb[ki-1] < vb[ki+1]) {
+				x = vb[ki+1]
+			} else {
+				x = vb[ki-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			vb[ki] = x
+			switch {
+			case x > n:
+				kbEnd += 2
+			case y > m:
+				kbStart += 2
+			case !front:
+				if fi := offset + delta - k; fi >= 0 && fi < len(vf) && vf[fi] != -1 {
+					fx := vf[fi]
+					if fx >= n-x {
+						return fx, fx - (fi - offset)
+					}
+				}
+			}
+		}
+	}
+	// The paths always meet before maxD; this is unreachable in practice,
+	// but replacing everything is still a correct result.
+	return n, 0
+}
+
+// Options controls the output of Unified.
+type Options struct {
+	Context int  // number of unchanged lines shown around each change
+	Color   bool // highlight the output using ANSI escape sequences
+}
+
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// Unified returns a unified diff of old and new, with oldName and newName
+// as the file names in its header. It returns nil if old and new are equal.
+func Unified(oldName, newName string, old, new []byte, opts Options) []byte {
+	oldLines, newLines := SplitLines(old), SplitLines(new)
+	edits := lineEdits(oldLines, newLines)
+	if len(edits) == 0 {
+		return nil
+	}
+	ctx := opts.Context
+	if ctx < 0 {
+		ctx = 0
+	}
+
+	var buf bytes.Buffer
+	line := func(color, prefix string, text []byte) {
+		if opts.Color && color != "" {
+			buf.WriteString(color)
+		}
+		buf.WriteString(prefix)
+		buf.Write(bytes.TrimSuffix(text, []byte("\n")))
+		if opts.Color && color != "" {
+			buf.WriteString(ansiReset)
+		}
+		buf.WriteByte('\n')
+		if len(text) == 0 || text[len(text)-1] != '\n' {
+			buf.WriteString("\\ No newline at end of file\n")
+		}
+	}
+	line(ansiBold, "--- ", []byte(oldName+"\n"))
+	line(ansiBold, "+++ ", []byte(newName+"\n"))
+
+	for i := 0; i < len(edits); {
+		// Changes whose contexts touch or overlap belong to the same hunk.
+		j := i
+		for j+1 < len(edits) && edits[j+1].OldStart-edits[j].OldEnd <= 2*ctx {
+			j++
+		}
+		first, last := edits[i], edits[j]
+		oldStart := first.OldStart - ctx
+		if oldStart < 0 {
+			oldStart = 0
+		}
+		newStart := first.NewStart - (first.OldStart - oldStart)
+		oldEnd := last.OldEnd + ctx
+		if oldEnd > len(oldLines) {
+			oldEnd = len(oldLines)
+		}
+		newEnd := last.NewEnd + (oldEnd - last.OldEnd)
+
+		header := fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(oldStart, oldEnd), hunkRange(newStart, newEnd))
+		line(ansiCyan, "", []byte(header))
+		pos := oldStart
+		for _, e := range edits[i : j+1] {
+			for _, l := range oldLines[pos:e.OldStart] {
+				line("", " ", l)
+			}
+			for _, l := range oldLines[e.OldStart:e.OldEnd] {
+				line(ansiRed, "-", l)
+			}
+			for _, l := range newLines[e.NewStart:e.NewEnd] {
+				line(ansiGreen, "+", l)
+			}
+			pos = e.OldEnd
+		}
+		for _, l := range oldLines[pos:oldEnd] {
+			line("", " ", l)
+		}
+		i = j + 1
+	}
+	return buf.Bytes()
+}
+
+// hunkRange formats the zero-based line range [start, end) as in a unified
+// diff hunk header: one-based, with the length omitted when it is one, and
+// an empty range numbered after the line it follows.
+func hunkRange(start, end int) string {
+	switch n := end - start; n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, n)
+	}
+}
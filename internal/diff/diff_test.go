@@ -0,0 +1,246 @@
+package diff
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		context  int
+		want     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			want: "",
+		},
+		{
+			name:    "insert_import",
+			old:     "package p\n\nfunc f() { fmt.Println() }\n",
+			new:     "package p\n\nimport \"fmt\"\n\nfunc f() { fmt.Println() }\n",
+			want:    "--- old\n+++ new\n@@ -1,3 +1,5 @@\n package p\n \n+import \"fmt\"\n+\n func f() { fmt.Println() }\n",
+			context: 3,
+		},
+		{
+			name: "replace",
+			old:  "a\nb\nc\n",
+			new:  "a\nx\nc\n",
+			want: `--- old
++++ new
+@@ -2 +2 @@
+-b
++x
+`,
+		},
+		{
+			name:    "separate_hunks",
+			old:     "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			new:     "1\nx\n3\n4\n5\n6\n7\ny\n9\n",
+			context: 1,
+			want: `--- old
++++ new
+@@ -1,3 +1,3 @@
+ 1
+-2
++x
+ 3
+@@ -7,3 +7,3 @@
+ 7
+-8
++y
+ 9
+`,
+		},
+		{
+			name:    "merged_hunks",
+			old:     "1\n2\n3\n4\n5\n",
+			new:     "1\nx\n3\n4\ny\n",
+			context: 1,
+			want: `--- old
++++ new
+@@ -1,5 +1,5 @@
+ 1
+-2
++x
+ 3
+ 4
+-5
++y
+`,
+		},
+		{
+			name:    "delete_all",
+			old:     "a\nb\n",
+			new:     "",
+			context: 3,
+			want: `--- old
++++ new
+@@ -1,2 +0,0 @@
+-a
+-b
+`,
+		},
+		{
+			name:    "missing_newline",
+			old:     "a\nb",
+			new:     "a\nb\n",
+			context: 3,
+			want: `--- old
++++ new
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Unified("old", "new", []byte(tt.old), []byte(tt.new), Options{Context: tt.context})
+			if string(got) != tt.want {
+				t.Errorf("Unified() =\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedColor(t *testing.T) {
+	got := string(Unified("old", "new", []byte("a\n"), []byte("b\n"), Options{Color: true}))
+	for _, want := range []string{ansiBold + "--- old" + ansiReset, ansiRed + "-a" + ansiReset, ansiGreen + "+b" + ansiReset} {
+		if !strings.Contains(got, want) {
+			t.Errorf("colored diff %q does not contain %q", got, want)
+		}
+	}
+}
+
+// TestEditsRandom checks that the edits computed for random texts turn the
+// old text into the new one, and change no more lines than necessary.
+func TestEditsRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gen := func() []byte {
+		var buf bytes.Buffer
+		for i, n := 0, rng.Intn(40); i < n; i++ {
+			buf.WriteByte("abcde"[rng.Intn(5)])
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes()
+	}
+	for i := 0; i < 1000; i++ {
+		old, new := gen(), gen()
+		oldLines, newLines := SplitLines(old), SplitLines(new)
+		edits := Edits(old, new)
+
+		var got [][]byte
+		pos, changed := 0, 0
+		for _, e := range edits {
+			if e.OldStart < pos || e.OldEnd < e.OldStart || e.NewEnd < e.NewStart {
+				t.Fatalf("invalid edit %+v after line %d", e, pos)
+			}
+			got = append(got, oldLines[pos:e.OldStart]...)
+			got = append(got, newLines[e.NewStart:e.NewEnd]...)
+			pos = e.OldEnd
+			changed += e.OldEnd - e.OldStart + e.NewEnd - e.NewStart
+		}
+		got = append(got, oldLines[pos:]...)
+		if !bytes.Equal(bytes.Join(got, nil), new) {
+			t.Fatalf("applying %v to %q = %q, want %q", edits, old, bytes.Join(got, nil), new)
+		}
+		if min := len(oldLines) + len(newLines) - 2*lcs(oldLines, newLines); changed != min {
+			t.Fatalf("edits %v change %d lines turning %q into %q, want %d", edits, changed, old, new, min)
+		}
+	}
+}
+
+// lcs returns the length of the longest common subsequence of a and b.
+func lcs(a, b [][]byte) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case bytes.Equal(a[i], b[j]):
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// TestParseApplyRandom checks that applying the parsed unified diff of
+// random texts to the old text gives the new one.
+func TestParseApplyRandom(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	gen := func() []byte {
+		var buf bytes.Buffer
+		for i, n := 0, rng.Intn(30); i < n; i++ {
+			buf.WriteByte("abcde"[rng.Intn(5)])
+			buf.WriteByte('\n')
+		}
+		if rng.Intn(4) == 0 && buf.Len() > 0 {
+			buf.Truncate(buf.Len() - 1) // no newline at the end
+		}
+		return buf.Bytes()
+	}
+	for i := 0; i < 1000; i++ {
+		old, new := gen(), gen()
+		patch := Unified("a/f.go", "b/f.go", old, new, Options{Context: rng.Intn(4)})
+		diffs, err := Parse(append([]byte("diff --git a/f.go b/f.go\n"), patch...))
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", patch, err)
+		}
+		if len(patch) == 0 {
+			if len(diffs) != 0 {
+				t.Fatalf("Parse of an empty patch returned %d diffs", len(diffs))
+			}
+			continue
+		}
+		if len(diffs) != 1 || diffs[0].OldName != "a/f.go" || diffs[0].NewName != "b/f.go" {
+			t.Fatalf("Parse(%q) = %+v, want one diff of f.go", patch, diffs)
+		}
+		got, err := diffs[0].Apply(old)
+		if err != nil {
+			t.Fatalf("applying %q to %q: %v", patch, old, err)
+		}
+		if !bytes.Equal(got, new) {
+			t.Fatalf("applying %q to %q = %q, want %q", patch, old, got, new)
+		}
+	}
+}
+
+func TestApplyMismatch(t *testing.T) {
+	old := []byte("package p\n\nfunc f() { fmt.Println() }\n")
+	new := []byte("package p\n\nimport \"fmt\"\n\nfunc f() { fmt.Println() }\n")
+	patch := append(Unified("f.go.orig", "f.go", old, new, Options{Context: 3}),
+		Unified("g.go.orig", "g.go", []byte("a\n"), []byte("b\n"), Options{})...)
+	diffs, err := Parse(patch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 2 || diffs[1].NewName != "g.go" {
+		t.Fatalf("Parse(%q) = %+v, want diffs of f.go and g.go", patch, diffs)
+	}
+	for _, changed := range []string{
+		"package q\n\nfunc f() { fmt.Println() }\n",
+		"package p\n\nfunc f() { fmt.Println() }",
+		"package p\n\n",
+	} {
+		if _, err := diffs[0].Apply([]byte(changed)); err == nil {
+			t.Errorf("applying %q to %q succeeded, want an error", patch, changed)
+		}
+	}
+
+	if _, err := Parse(Unified("old", "new", old, new, Options{Color: true})); err == nil {
+		t.Errorf("Parse of a colored diff succeeded, want an error")
+	}
+}
@@ -0,0 +1,177 @@
+package diff
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A FileDiff is the unified diff of a file, as formatted by Unified.
+type FileDiff struct {
+	OldName, NewName string
+	Hunks            []*Hunk
+}
+
+// A Hunk replaces the lines Old of the old text, starting at the zero-based
+// line OldStart, with the lines New. Lines keep their trailing newline, if
+// any.
+type Hunk struct {
+	OldStart int
+	Old, New [][]byte
+}
+
+// Parse parses the unified diffs of the files in patch. Lines outside of
+// the diffs, such as the "diff" command lines preceding them, are ignored.
+func Parse(patch []byte) ([]*FileDiff, error) {
+	if bytes.Contains(patch, []byte("\x1b[")) {
+		return nil, errors.New("colored diffs can't be parsed")
+	}
+	lines := SplitLines(patch)
+	var diffs []*FileDiff
+	var d *FileDiff
+	for i := 0; i < len(lines); i++ {
+		line := string(lines[i])
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(string(lines[i+1]), "+++ "):
+			d = &FileDiff{
+				OldName: strings.TrimSuffix(line[len("--- "):], "\n"),
+				NewName: strings.TrimSuffix(string(lines[i+1][len("+++ "):]), "\n"),
+			}
+			diffs = append(diffs, d)
+			i++
+		case strings.HasPrefix(line, "@@ "):
+			if d == nil {
+				return nil, fmt.Errorf("line %d: hunk outside of a file diff", i+1)
+			}
+			h, n, err := parseHunk(lines[i:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			if k := len(d.Hunks); k > 0 && h.OldStart < d.Hunks[k-1].OldStart+len(d.Hunks[k-1].Old) {
+				return nil, fmt.Errorf("line %d: hunk overlaps the previous one", i+1)
+			}
+			d.Hunks = append(d.Hunks, h)
+			i += n - 1
+		default:
+			// Lines between file diffs end the current one.
+			d = nil
+		}
+	}
+	return diffs, nil
+}
+
+// parseHunk parses the hunk at the start of lines and returns it along with
+// the number of lines it spans.
+func parseHunk(lines [][]byte) (*Hunk, int, error) {
+	header := strings.TrimSuffix(string(lines[0]), "\n")
+	var oldRange, newRange string
+	if n, _ := fmt.Sscanf(header, "@@ -%s +%s @@", &oldRange, &newRange); n != 2 {
+		return nil, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+	oldStart, oldLen, err1 := parseRange(oldRange)
+	_, newLen, err2 := parseRange(newRange)
+	if err1 != nil || err2 != nil {
+		return nil, 0, fmt.Errorf("invalid hunk header %q", header)
+	}
+
+	h := &Hunk{OldStart: oldStart}
+	n := 1
+	lastOld, lastNew := -1, -1 // the last line read, on either side
+	for ; n < len(lines); n++ {
+		line := lines[n]
+		if len(line) > 0 && line[0] == '\\' {
+			// "\ No newline at end of file" applies to the last line.
+			if lastOld >= 0 {
+				h.Old[lastOld] = bytes.TrimSuffix(h.Old[lastOld], []byte("\n"))
+			}
+			if lastNew >= 0 {
+				h.New[lastNew] = bytes.TrimSuffix(h.New[lastNew], []byte("\n"))
+			}
+			continue
+		}
+		if len(h.Old) == oldLen && len(h.New) == newLen {
+			break
+		}
+		if len(line) == 0 || line[0] == '\n' {
+			// A context line whose leading space was stripped.
+			line = []byte(" \n")
+		}
+		text := line[1:]
+		lastOld, lastNew = -1, -1
+		switch line[0] {
+		case ' ':
+			lastOld, lastNew = len(h.Old), len(h.New)
+			h.Old = append(h.Old, text)
+			h.New = append(h.New, text)
+		case '-':
+			lastOld = len(h.Old)
+			h.Old = append(h.Old, text)
+		case '+':
+			lastNew = len(h.New)
+			h.New = append(h.New, text)
+		default:
+			return nil, 0, fmt.Errorf("invalid line %q in hunk", line)
+		}
+		if len(h.Old) > oldLen || len(h.New) > newLen {
+			return nil, 0, errors.New("hunk longer than its header says")
+		}
+	}
+	if len(h.Old) != oldLen || len(h.New) != newLen {
+		return nil, 0, errors.New("hunk shorter than its header says")
+	}
+	return h, n, nil
+}
+
+// parseRange parses a range of a hunk header, as formatted by hunkRange,
+// and returns its zero-based start and its length.
+func parseRange(s string) (start, n int, err error) {
+	first, length, ok := strings.Cut(s, ",")
+	n = 1
+	if ok {
+		if n, err = strconv.Atoi(length); err != nil {
+			return 0, 0, err
+		}
+	}
+	if start, err = strconv.Atoi(first); err != nil {
+		return 0, 0, err
+	}
+	if n > 0 {
+		start-- // an empty range is numbered after the line it follows
+	}
+	if start < 0 || n < 0 {
+		return 0, 0, fmt.Errorf("invalid range %q", s)
+	}
+	return start, n, nil
+}
+
+// Apply applies d to old, which must match the lines d replaces and
+// shows as context, and returns the result.
+func (d *FileDiff) Apply(old []byte) ([]byte, error) {
+	oldLines := SplitLines(old)
+	var buf bytes.Buffer
+	pos := 0
+	for _, h := range d.Hunks {
+		end := h.OldStart + len(h.Old)
+		if end > len(oldLines) {
+			return nil, fmt.Errorf("hunk at line %d goes past the end of the file", h.OldStart+1)
+		}
+		for i, l := range h.Old {
+			if !bytes.Equal(oldLines[h.OldStart+i], l) {
+				return nil, fmt.Errorf("line %d doesn't match the diff", h.OldStart+i+1)
+			}
+		}
+		for _, l := range oldLines[pos:h.OldStart] {
+			buf.Write(l)
+		}
+		for _, l := range h.New {
+			buf.Write(l)
+		}
+		pos = end
+	}
+	for _, l := range oldLines[pos:] {
+		buf.Write(l)
+	}
+	return buf.Bytes(), nil
+}
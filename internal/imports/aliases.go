@@ -0,0 +1,279 @@
+package imports
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"path/filepath"
+)
+
+// An aliasPolicy says how the imports of a file must be named, as set by
+// Options.Aliases and Options.RemoveRedundantAliases.
+type aliasPolicy struct {
+	aliases         map[string]string // required names by import path
+	removeRedundant bool
+
+	// declared holds the names declared at package level by the other
+	// files of the package, which the names required must not shadow.
+	declared map[string]bool
+}
+
+// aliasPolicy returns the alias policy of opt, or nil if it has none.
+func (opt *Options) aliasPolicy() *aliasPolicy {
+	if len(opt.Aliases) == 0 && !opt.RemoveRedundantAliases {
+		return nil
+	}
+	return &aliasPolicy{aliases: opt.Aliases, removeRedundant: opt.RemoveRedundantAliases}
+}
+
+// CheckAlias returns an error if name can't be required as the name of the
+// imports of importPath by Options.Aliases.
+func CheckAlias(importPath, name string) error {
+	if importPath == "" || importPath == "C" {
+		return fmt.Errorf("invalid import path %q for an alias", importPath)
+	}
+	if !token.IsIdentifier(name) || name == "_" {
+		return fmt.Errorf("invalid alias %q for %q", name, importPath)
+	}
+	return nil
+}
+
+// assumeAliasesValid adds the imports named by the alias policy as
+// candidates for the missing references using their names, assuming that
+// the packages export the symbols referenced.
+func (p *pass) assumeAliasesValid() {
+	if p.aliases == nil {
+		return
+	}
+	for path, alias := range p.aliases.aliases {
+		if rights, ok := p.missingRefs[alias]; ok {
+			p.addCandidate(&ImportInfo{ImportPath: path, Name: alias}, &packageInfo{exports: rights})
+		}
+	}
+}
+
+// loadNamedPackageNames loads the package names of the imports of the file
+// named as implied by their import paths, so that those named after their
+// package can be found redundant.
+func (p *pass) loadNamedPackageNames() {
+	var named []*ImportInfo
+	for _, imp := range p.existingImports {
+		if _, ok := stdlib[imp.ImportPath]; !ok && imp.Name != "" && imp.Name == ImportPathToAssumedName(imp.ImportPath) {
+			named = append(named, imp)
+		}
+	}
+	if len(named) == 0 {
+		return
+	}
+	if err := p.loadPackageNames(named); err != nil && p.env.Logf != nil {
+		p.env.Logf("loading package names: %v", err)
+	}
+}
+
+// policyName returns the name the import imp, which would otherwise be
+// named name, must have under the alias policy. If the name required is
+// taken, it returns name along with an AliasConflict fix. taken records the
+// names already required for other imports of the file.
+func (p *pass) policyName(imp *ImportInfo, name string, taken map[string]bool) (string, *ImportFix) {
+	if p.aliases == nil {
+		return name, nil
+	}
+	ident := p.importIdentifier(imp)
+	alias, ok := p.aliases.aliases[imp.ImportPath]
+	switch {
+	case ok && alias != ident:
+		if taken[alias] || p.aliases.declared[alias] || usesName(p.f, alias) {
+			return name, &ImportFix{
+				StmtInfo:  ImportInfo{ImportPath: imp.ImportPath, Name: alias},
+				IdentName: ident,
+				FixType:   AliasConflict,
+			}
+		}
+		taken[alias] = true
+		return alias, nil
+	case !ok && name != "" && p.aliases.removeRedundant && p.redundantName(imp.ImportPath, name):
+		return "", nil
+	}
+	return name, nil
+}
+
+// redundantName reports whether naming the import of importPath name has
+// no effect, because it is both the name of the package and the one implied
+// by its import path, like errors "errors".
+func (p *pass) redundantName(importPath, name string) bool {
+	if name != ImportPathToAssumedName(importPath) {
+		return false
+	}
+	if _, ok := stdlib[importPath]; ok {
+		// Standard packages are named after their import paths.
+		return true
+	}
+	known := p.knownPackages[importPath]
+	return known != nil && known.name == name
+}
+
+// packageLevelNames returns the names declared at package level by the
+// files of package pkg among files.
+func packageLevelNames(files []*ast.File, pkg string) map[string]bool {
+	names := map[string]bool{}
+	for _, f := range files {
+		if f.Name.Name != pkg || f.Scope == nil {
+			continue
+		}
+		for name := range f.Scope.Objects {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// usesName reports whether f uses name other than as the name of an import
+// or the selected name of a selector: for something it declares, or for a
+// declaration of the package or the universe it refers to.
+func usesName(f *ast.File, name string) bool {
+	found := false
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.SelectorExpr:
+			ast.Inspect(n.X, visit)
+			return false
+		case *ast.Ident:
+			found = found || n.Name == name
+		}
+		return !found
+	}
+	for _, decl := range f.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			continue
+		}
+		ast.Inspect(decl, visit)
+	}
+	return found
+}
+
+// renameReferences renames the package identifier from to to in the
+// selector expressions of f referring to a package.
+func renameReferences(f *ast.File, from, to string) {
+	if from == "" || to == "" || from == to {
+		return
+	}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && x.Obj == nil && x.Name == from {
+				x.Name = to
+			}
+		}
+		return true
+	})
+}
+
+// An ImportUse describes how a file refers to a package it imports.
+type ImportUse struct {
+	ImportPath string
+	Name       string // the name of the import, or "" if none
+	Ident      string // the identifier the file refers to the package by
+}
+
+// ImportUses returns how the file in src refers to the packages it imports
+// and uses, leaving out blank and dot imports and "C". There are none for
+// generated files, unless opt.Generated is GeneratedFull.
+func ImportUses(filename string, src []byte, opt *Options) ([]*ImportUse, error) {
+	fileSet := token.NewFileSet()
+	file, _, err := parse(fileSet, filename, src, opt)
+	if err != nil {
+		return nil, err
+	}
+	if opt.Generated != GeneratedFull && isGenerated(src) {
+		return nil, nil
+	}
+	p, imps, err := namingPass(fileSet, file, filename, opt.Env)
+	if err != nil {
+		return nil, err
+	}
+	refs := collectReferences(file)
+	var uses []*ImportUse
+	for _, imp := range imps {
+		ident := p.importIdentifier(imp)
+		if _, ok := refs[ident]; ok {
+			uses = append(uses, &ImportUse{ImportPath: imp.ImportPath, Name: imp.Name, Ident: ident})
+		}
+	}
+	return uses, nil
+}
+
+// RenameImports makes the file in src refer to the packages of idents,
+// keyed by import path, by the identifiers given, renaming its imports and
+// the references to them, and formats it as Process does. The imports of
+// other packages are left alone, and generated files are returned as is
+// unless opt.Generated is GeneratedFull. It returns the
+// fixes made, along with AliasConflict fixes for the imports that keep
+// their name because the file uses the identifier for something else.
+func RenameImports(filename string, src []byte, idents map[string]string, opt *Options) ([]byte, []*ImportFix, error) {
+	fileSet := token.NewFileSet()
+	file, adjust, err := parse(fileSet, filename, src, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opt.Generated != GeneratedFull && isGenerated(src) {
+		return src, nil, nil
+	}
+	p, imps, err := namingPass(fileSet, file, filename, opt.Env)
+	if err != nil {
+		return nil, nil, err
+	}
+	p.aliases = &aliasPolicy{
+		aliases:  idents,
+		declared: packageLevelNames(parseOtherFiles(fileSet, p.srcDir, filename, opt.Overlay), file.Name.Name),
+	}
+	var fixes []*ImportFix
+	taken := map[string]bool{}
+	for _, imp := range imps {
+		if _, ok := idents[imp.ImportPath]; !ok {
+			continue
+		}
+		name, conflict := p.policyName(imp, imp.Name, taken)
+		if conflict != nil {
+			fixes = append(fixes, conflict)
+			continue
+		}
+		if name != imp.Name && name != "" && p.redundantName(imp.ImportPath, name) {
+			name = ""
+		}
+		if name != imp.Name {
+			fixes = append(fixes, &ImportFix{
+				StmtInfo:  ImportInfo{ImportPath: imp.ImportPath, Name: name},
+				IdentName: p.importIdentifier(imp),
+				FixType:   SetImportName,
+			})
+		}
+	}
+	apply(fileSet, file, fixes)
+	formatted, err := formatFile(fileSet, file, src, adjust, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return formatted, fixes, nil
+}
+
+// namingPass returns a pass over file, which is named filename, with the
+// package names of its imports loaded, and the imports.
+func namingPass(fset *token.FileSet, file *ast.File, filename string, env *ProcessEnv) (*pass, []*ImportInfo, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := &pass{
+		fset:                 fset,
+		f:                    file,
+		srcDir:               filepath.Dir(abs),
+		env:                  env,
+		loadRealPackageNames: true,
+		knownPackages:        map[string]*packageInfo{},
+	}
+	imps := collectImports(file)
+	if err := p.loadPackageNames(imps); err != nil {
+		return nil, nil, err
+	}
+	return p, imps, nil
+}
@@ -0,0 +1,397 @@
+package imports
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/packages/packagestest"
+)
+
+func TestAliasPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		out     string
+		aliases map[string]string
+		others  fm // other files of the module
+	}{
+		{
+			name:    "rename_existing_import",
+			aliases: map[string]string{"foo.com/api/core/v1": "corev1"},
+			in: `package x
+
+import "foo.com/api/core/v1"
+
+var _ = v1.Pod{}
+
+func f(p v1.Pod) v1.Pod { return p }
+`,
+			out: `package x
+
+import corev1 "foo.com/api/core/v1"
+
+var _ = corev1.Pod{}
+
+func f(p corev1.Pod) corev1.Pod { return p }
+`,
+		},
+		{
+			name:    "add_import_with_alias",
+			aliases: map[string]string{"foo.com/api/core/v1": "corev1"},
+			in: `package x
+
+var _ = v1.Pod{}
+`,
+			out: `package x
+
+import corev1 "foo.com/api/core/v1"
+
+var _ = corev1.Pod{}
+`,
+		},
+		{
+			name:    "add_import_by_alias",
+			aliases: map[string]string{"foo.com/api/core/v1": "corev1"},
+			in: `package x
+
+var _ = corev1.Pod{}
+`,
+			out: `package x
+
+import corev1 "foo.com/api/core/v1"
+
+var _ = corev1.Pod{}
+`,
+		},
+		{
+			name:    "remove_redundant_alias",
+			aliases: map[string]string{},
+			in: `package x
+
+import (
+	errors "errors"
+	_ "fmt"
+	strings "strings"
+	v1 "foo.com/api/core/v1"
+)
+
+var _, _, _ = errors.New, strings.Cut, v1.Pod{}
+`,
+			out: `package x
+
+import (
+	"errors"
+	_ "fmt"
+	"strings"
+
+	v1 "foo.com/api/core/v1"
+)
+
+var _, _, _ = errors.New, strings.Cut, v1.Pod{}
+`,
+		},
+		{
+			name:    "required_alias_not_redundant",
+			aliases: map[string]string{"errors": "errors"},
+			in: `package x
+
+import errors "errors"
+
+var _ = errors.New
+`,
+			out: `package x
+
+import errors "errors"
+
+var _ = errors.New
+`,
+		},
+		{
+			name:    "conflict_with_local_identifier",
+			aliases: map[string]string{"foo.com/api/core/v1": "corev1"},
+			in: `package x
+
+import "foo.com/api/core/v1"
+
+func f() {
+	corev1 := v1.Pod{}
+	_ = corev1
+}
+`,
+			out: `package x
+
+import v1 "foo.com/api/core/v1"
+
+func f() {
+	corev1 := v1.Pod{}
+	_ = corev1
+}
+`,
+		},
+		{
+			name:    "conflict_with_package_declaration",
+			aliases: map[string]string{"foo.com/api/core/v1": "corev1"},
+			others:  fm{"x/y.go": "package x\n\nvar corev1 int\n"},
+			in: `package x
+
+import "foo.com/api/core/v1"
+
+var _ = v1.Pod{}
+`,
+			out: `package x
+
+import v1 "foo.com/api/core/v1"
+
+var _ = v1.Pod{}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := fm{"api/core/v1/x.go": "package v1\ntype Pod struct{}\n", "x/x.go": tt.in}
+			for name, src := range tt.others {
+				files[name] = src
+			}
+			testConfig{
+				modules: []packagestest.Module{
+					{
+						Name:  "foo.com",
+						Files: files,
+					},
+				},
+			}.test(t, func(t *goimportTest) {
+				opts := &Options{
+					Comments:               true,
+					TabIndent:              true,
+					TabWidth:               8,
+					Aliases:                tt.aliases,
+					RemoveRedundantAliases: true,
+				}
+				t.assertProcessEquals("foo.com", "x/x.go", nil, opts, tt.out)
+			})
+		})
+	}
+}
+
+func TestAliasConflict(t *testing.T) {
+	const src = `package x
+
+import "foo.com/api/core/v1"
+
+var corev1 = v1.Pod{}
+`
+	testConfig{
+		module: packagestest.Module{
+			Name:  "foo.com",
+			Files: fm{"api/core/v1/x.go": "package v1\ntype Pod struct{}\n", "x/x.go": src},
+		},
+	}.test(t, func(t *goimportTest) {
+		opts := &Options{
+			Env:       t.env.CopyConfig(),
+			Comments:  true,
+			TabIndent: true,
+			TabWidth:  8,
+			Aliases:   map[string]string{"foo.com/api/core/v1": "corev1"},
+		}
+		got, fixes, err := ProcessFixes(t.exported.File("foo.com", "x/x.go"), []byte(src), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The package name differs from the one implied by the import
+		// path, so the import is named, but not as the policy requires.
+		const want = `package x
+
+import v1 "foo.com/api/core/v1"
+
+var corev1 = v1.Pod{}
+`
+		if string(got) != want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+		var conflicts []ImportFix
+		for _, fix := range fixes {
+			if fix.FixType == AliasConflict {
+				conflicts = append(conflicts, *fix)
+			}
+		}
+		wantConflict := ImportFix{StmtInfo: ImportInfo{ImportPath: "foo.com/api/core/v1", Name: "corev1"}, IdentName: "v1", FixType: AliasConflict}
+		if len(conflicts) != 1 || conflicts[0] != wantConflict {
+			t.Errorf("got conflicts %+v, want %+v", conflicts, wantConflict)
+		}
+	})
+}
+
+func TestCheckAlias(t *testing.T) {
+	for _, tt := range []struct {
+		path, name string
+		ok         bool
+	}{
+		{"k8s.io/api/core/v1", "corev1", true},
+		{"k8s.io/api/core/v1", "_", false},
+		{"k8s.io/api/core/v1", ".", false},
+		{"k8s.io/api/core/v1", "core-v1", false},
+		{"k8s.io/api/core/v1", "", false},
+		{"C", "c", false},
+		{"", "x", false},
+	} {
+		if err := CheckAlias(tt.path, tt.name); (err == nil) != tt.ok {
+			t.Errorf("CheckAlias(%q, %q) = %v, want ok = %v", tt.path, tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestRenamesReferences(t *testing.T) {
+	for _, tt := range []struct {
+		fix  ImportFix
+		want bool
+	}{
+		{ImportFix{StmtInfo: ImportInfo{ImportPath: "fmt"}, IdentName: "fmt", FixType: AddImport}, false},
+		{ImportFix{StmtInfo: ImportInfo{ImportPath: "fmt", Name: "format"}, IdentName: "fmt", FixType: AddImport}, true},
+		{ImportFix{StmtInfo: ImportInfo{ImportPath: "gopkg.in/yaml.v3", Name: "yaml"}, IdentName: "yaml", FixType: AddImport}, false},
+		{ImportFix{StmtInfo: ImportInfo{ImportPath: "fmt", Name: "format"}, IdentName: "fmt", FixType: SetImportName}, true},
+		{ImportFix{StmtInfo: ImportInfo{ImportPath: "errors"}, IdentName: "errors", FixType: SetImportName}, false},
+		{ImportFix{StmtInfo: ImportInfo{ImportPath: "errors"}, IdentName: "errs", FixType: SetImportName}, true},
+		{ImportFix{StmtInfo: ImportInfo{ImportPath: "fmt", Name: "format"}, IdentName: "fmt", FixType: DeleteImport}, false},
+		{ImportFix{StmtInfo: ImportInfo{ImportPath: "fmt", Name: "format"}, IdentName: "fmt", FixType: AliasConflict}, false},
+	} {
+		if got := tt.fix.RenamesReferences(); got != tt.want {
+			t.Errorf("%+v.RenamesReferences() = %v, want %v", tt.fix, got, tt.want)
+		}
+	}
+}
+
+func TestImportUses(t *testing.T) {
+	const src = `package x
+
+import (
+	"errors"
+	_ "fmt"
+	meta "foo.com/api/meta/v1"
+	"foo.com/api/core/v1"
+	"strings"
+)
+
+var _, _, _ = errors.New, meta.Time{}, v1.Pod{}
+`
+	testConfig{
+		module: packagestest.Module{
+			Name: "foo.com",
+			Files: fm{
+				"api/core/v1/x.go": "package v1\ntype Pod struct{}\n",
+				"api/meta/v1/x.go": "package v1\ntype Time struct{}\n",
+				"x/x.go":           src,
+			},
+		},
+	}.test(t, func(t *goimportTest) {
+		opts := &Options{Env: t.env.CopyConfig(), Comments: true}
+		uses, err := ImportUses(t.exported.File("foo.com", "x/x.go"), []byte(src), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []*ImportUse{
+			{ImportPath: "errors", Ident: "errors"},
+			{ImportPath: "foo.com/api/meta/v1", Name: "meta", Ident: "meta"},
+			{ImportPath: "foo.com/api/core/v1", Ident: "v1"},
+		}
+		if !reflect.DeepEqual(uses, want) {
+			t.Errorf("ImportUses() = %v, want %v", uses, want)
+		}
+	})
+}
+
+func TestRenameImports(t *testing.T) {
+	const src = `package x
+
+import (
+	errs "errors"
+	fmt "fmt"
+	os "os"
+	"foo.com/api/core/v1"
+	metav1 "foo.com/api/meta/v1"
+)
+
+var _, _, _, _, _ = errs.New, fmt.Sprint, os.Exit, v1.Pod{}, metav1.Time{}
+
+func f(corev1 int) {}
+`
+	const want = `package x
+
+import (
+	"errors"
+	fmt "fmt"
+	os "os"
+
+	"foo.com/api/core/v1"
+	meta "foo.com/api/meta/v1"
+)
+
+var _, _, _, _, _ = errors.New, fmt.Sprint, os.Exit, v1.Pod{}, meta.Time{}
+
+func f(corev1 int) {}
+`
+	testConfig{
+		module: packagestest.Module{
+			Name: "foo.com",
+			Files: fm{
+				"api/core/v1/x.go": "package v1\ntype Pod struct{}\n",
+				"api/meta/v1/x.go": "package v1\ntype Time struct{}\n",
+				"x/x.go":           src,
+			},
+		},
+	}.test(t, func(t *goimportTest) {
+		opts := &Options{Env: t.env.CopyConfig(), Comments: true, TabIndent: true, TabWidth: 8}
+		// The redundant names of fmt, which has no majority, and of os,
+		// which is referred to as the majority does, are kept.
+		idents := map[string]string{
+			"errors":              "errors",
+			"os":                  "os",
+			"foo.com/api/core/v1": "corev1",
+			"foo.com/api/meta/v1": "meta",
+		}
+		got, fixes, err := RenameImports(t.exported.File("foo.com", "x/x.go"), []byte(src), idents, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != want {
+			t.Errorf("got:\n%s\nwant:\n%s", got, want)
+		}
+		var conflicts []string
+		for _, fix := range fixes {
+			if fix.FixType == AliasConflict {
+				conflicts = append(conflicts, fix.StmtInfo.ImportPath)
+			}
+		}
+		if want := []string{"foo.com/api/core/v1"}; !reflect.DeepEqual(conflicts, want) {
+			t.Errorf("conflicts = %q, want %q", conflicts, want)
+		}
+	})
+}
+
+func TestImportUsesGenerated(t *testing.T) {
+	const src = `// Code generated by hand. DO NOT EDIT.
+
+package x
+
+import errs "errors"
+
+var _ = errs.New
+`
+	idents := map[string]string{"errors": "errors"}
+	for _, policy := range []GeneratedPolicy{GeneratedFormatOnly, GeneratedSkip} {
+		opts := &Options{Comments: true, TabIndent: true, TabWidth: 8, Generated: policy}
+		uses, err := ImportUses("x.go", []byte(src), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(uses) != 0 {
+			t.Errorf("policy %d: ImportUses() = %v, want none", policy, uses)
+		}
+		got, fixes, err := RenameImports("x.go", []byte(src), idents, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != src || len(fixes) != 0 {
+			t.Errorf("policy %d: RenameImports() got %d fixes and:\n%s\nwant the file unchanged", policy, len(fixes), got)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package imports
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/rinchsan/gosimports/internal/gocommand"
+	"github.com/rinchsan/gosimports/internal/gopathwalk"
+)
+
+// A Diagnosis describes the environment in which imports are resolved, for
+// troubleshooting slow or unexpected results.
+type Diagnosis struct {
+	WorkingDir string
+	Env        map[string]string // ProcessEnv.Env, with the go env variables
+
+	Resolver       string // "module" or "GOPATH"
+	ResolverReason string // why the resolver was chosen
+	Vendor         bool   // whether packages are found in the vendor directory
+
+	MainModules    []*gocommand.ModuleJSON
+	ModuleCacheDir string
+
+	Roots []*RootScan // in the order they are scanned
+
+	// The number of directories known to the caches of the resolver once
+	// the roots are scanned.
+	ModuleCacheDirs, OtherDirs int
+
+	Errors []string // errors of the go command, or finding packages
+}
+
+// A RootScan describes the scan of a directory tree for packages.
+type RootScan struct {
+	Path     string
+	Type     string // GOROOT, GOPATH, main module, module cache or other
+	Dirs     int    // directories with Go files found
+	Duration time.Duration
+}
+
+var rootTypeNames = map[gopathwalk.RootType]string{
+	gopathwalk.RootGOROOT:        "GOROOT",
+	gopathwalk.RootGOPATH:        "GOPATH",
+	gopathwalk.RootCurrentModule: "main module",
+	gopathwalk.RootModuleCache:   "module cache",
+	gopathwalk.RootOther:         "other",
+}
+
+// Diagnose initializes env, scans all the directories its resolver finds
+// packages in, timing each, and describes the result. It reports the
+// errors it meets in the Diagnosis, going as far as they allow.
+func Diagnose(env *ProcessEnv) *Diagnosis {
+	d := &Diagnosis{WorkingDir: env.WorkingDir}
+	if err := env.init(); err != nil {
+		d.Errors = append(d.Errors, fmt.Sprintf("go env: %v", err))
+		return d
+	}
+	d.Env = map[string]string{}
+	for k, v := range env.Env {
+		d.Env[k] = v
+	}
+
+	resolver, err := env.GetResolver()
+	if err != nil {
+		d.Errors = append(d.Errors, err.Error())
+		return d
+	}
+	switch r := resolver.(type) {
+	case *ModuleResolver:
+		d.Resolver = "module"
+		if gowork := env.Env["GOWORK"]; gowork != "" {
+			d.ResolverReason = "GOWORK is " + gowork
+		} else {
+			d.ResolverReason = "GOMOD is " + env.Env["GOMOD"]
+		}
+		if err := r.init(); err != nil {
+			d.Errors = append(d.Errors, err.Error())
+			return d
+		}
+		d.Vendor = r.dummyVendorMod != nil
+		d.MainModules = r.mains
+		d.ModuleCacheDir = r.moduleCacheDir
+
+		<-r.scanSema
+		defer func() { r.scanSema <- struct{}{} }()
+		for _, root := range r.roots {
+			d.Roots = append(d.Roots, scanRoot(root, func(dir string) {
+				r.cacheStore(r.scanDirForPackage(root, dir))
+			}, env.Logf, true))
+			r.scannedRoots[root] = true
+		}
+		d.ModuleCacheDirs = r.moduleCacheCache.len()
+		d.OtherDirs = r.otherCache.len()
+
+	case *gopathResolver:
+		d.Resolver = "GOPATH"
+		d.ResolverReason = fmt.Sprintf("GOMOD and GOWORK are empty (GO111MODULE=%q)", env.Env["GO111MODULE"])
+
+		<-r.scanSema
+		defer func() { r.scanSema <- struct{}{} }()
+		roots := []gopathwalk.Root{{Path: filepath.Join(env.Env["GOROOT"], "src"), Type: gopathwalk.RootGOROOT}}
+		for _, p := range filepath.SplitList(env.Env["GOPATH"]) {
+			roots = append(roots, gopathwalk.Root{Path: filepath.Join(p, "src"), Type: gopathwalk.RootGOPATH})
+		}
+		for _, root := range roots {
+			d.Roots = append(d.Roots, scanRoot(root, func(dir string) {
+				importpath := filepath.ToSlash(dir[len(root.Path)+len("/"):])
+				r.cache.Store(dir, directoryPackageInfo{
+					status:                 directoryScanned,
+					dir:                    dir,
+					rootType:               root.Type,
+					nonCanonicalImportPath: VendorlessPath(importpath),
+				})
+			}, env.Logf, false))
+		}
+		d.OtherDirs = r.cache.len()
+	}
+	return d
+}
+
+// scanRoot walks root, calling add for each directory with Go files found,
+// and returns how long it took.
+func scanRoot(root gopathwalk.Root, add func(dir string), logf func(string, ...interface{}), modules bool) *RootScan {
+	var dirs int64
+	start := time.Now()
+	gopathwalk.Walk([]gopathwalk.Root{root}, func(_ gopathwalk.Root, dir string) {
+		atomic.AddInt64(&dirs, 1)
+		add(dir)
+	}, gopathwalk.Options{Logf: logf, ModulesEnabled: modules})
+	return &RootScan{
+		Path:     root.Path,
+		Type:     rootTypeNames[root.Type],
+		Dirs:     int(atomic.LoadInt64(&dirs)),
+		Duration: time.Since(start),
+	}
+}
+
+// len returns the number of directories in the cache.
+func (d *dirInfoCache) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.dirs)
+}
@@ -0,0 +1,53 @@
+package imports
+
+import (
+	"testing"
+
+	"github.com/rinchsan/gosimports/internal/gopathwalk"
+)
+
+func TestDiagnose(t *testing.T) {
+	mt := setup(t, nil, `
+-- go.mod --
+module x
+
+require example.com v1.0.0
+
+-- x.go --
+package x
+import _ "example.com"
+
+-- y/y.go --
+package y
+`, "")
+	defer mt.cleanup()
+
+	d := Diagnose(mt.env)
+	if len(d.Errors) > 0 {
+		t.Fatalf("Diagnose errors: %v", d.Errors)
+	}
+	if d.Resolver != "module" {
+		t.Errorf("Resolver = %q, want module", d.Resolver)
+	}
+	if d.Env["GOMOD"] == "" {
+		t.Errorf("GOMOD missing from Env %v", d.Env)
+	}
+	if len(d.MainModules) != 1 || d.MainModules[0].Path != "x" {
+		t.Errorf("MainModules = %v, want x", d.MainModules)
+	}
+	var main *RootScan
+	for _, root := range d.Roots {
+		if root.Type == rootTypeNames[gopathwalk.RootCurrentModule] {
+			main = root
+		}
+	}
+	if main == nil || main.Dirs != 2 {
+		t.Errorf("main module root = %+v, want 2 directories", main)
+	}
+	if d.ModuleCacheDirs == 0 || d.OtherDirs < 2 {
+		t.Errorf("cached directories = %d, %d; want some in both caches", d.ModuleCacheDirs, d.OtherDirs)
+	}
+
+	// The scan is reused by the resolver.
+	mt.assertScanFinds("example.com", "x")
+}
@@ -0,0 +1,297 @@
+package imports
+
+import (
+	"fmt"
+	"go/token"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// An Explanation describes the decisions made while fixing the imports of a
+// file: why imports were added, removed or renamed, and how the package
+// referred to by each unresolved identifier was chosen.
+type Explanation struct {
+	// Skipped is the reason the imports were not fixed, if they weren't.
+	Skipped string
+
+	Fixes []*ExplainedFix   // sorted by fix type and import path
+	Refs  []*RefExplanation // sorted by name
+}
+
+// An ExplainedFix is a fix along with the reason for it.
+type ExplainedFix struct {
+	Fix    *ImportFix
+	Reason string
+}
+
+// A RefExplanation describes the search for the package referred to by an
+// identifier the file uses without importing it.
+type RefExplanation struct {
+	Name    string   // the package identifier, e.g. "rand" in rand.Int
+	Symbols []string // the symbols referenced through it, sorted
+
+	// Candidates lists the packages considered, in the order they were.
+	Candidates []*Candidate
+
+	// Chosen is the import path of the package imported, or "" if none
+	// of the candidates is suitable.
+	Chosen string
+}
+
+// A CandidateSource says where a candidate package was found.
+type CandidateSource string
+
+const (
+	SourceSibling CandidateSource = "imported by another file of the package"
+	SourceStdlib  CandidateSource = "standard library"
+	SourceScan    CandidateSource = "found in GOPATH or the module graph"
+)
+
+// A Candidate is a package considered for an unresolved identifier.
+type Candidate struct {
+	ImportPath string
+	Source     CandidateSource
+	Dir        string  // the directory of the package, if known
+	Distance   int     // the number of directories from the file to Dir, or -1 if unknown
+	Relevance  float64 // up to MaxRelevance, or 0 if unknown
+	OutOfScope bool    // whether, in module mode, no module in go.mod provides the package
+	Rejected   string  // why the candidate was not chosen, or "" if it was
+}
+
+// Explain is like ProcessFixes, but rather than fixing the file, it explains
+// the fixes that would be made.
+func Explain(filename string, src []byte, opt *Options) (*Explanation, error) {
+	fileSet := token.NewFileSet()
+	file, _, err := parse(fileSet, filename, src, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opt.FormatOnly:
+		return &Explanation{Skipped: "imports are not fixed in format-only mode"}, nil
+	case opt.Generated != GeneratedFull && isGenerated(src):
+		return &Explanation{Skipped: "imports of generated files are not fixed"}, nil
+	}
+	ex := &explainer{}
+	fixes, err := getFixes(fileSet, file, filename, opt.Env, opt.Overlay, opt.aliasPolicy(), ex)
+	if err != nil {
+		return nil, err
+	}
+	return ex.explanation(fixes), nil
+}
+
+// An explainer records the decisions made by a pass, for Explain. Its
+// methods do nothing when called on a nil *explainer.
+type explainer struct {
+	mu      sync.Mutex
+	missing references
+	sources map[string]CandidateSource // by import path
+	scanned map[string][]*Candidate    // by identifier, from addExternalCandidates
+	matched map[string][]*Candidate    // by identifier, from the latest fix
+}
+
+// setMissing records the references the file is missing imports for.
+func (ex *explainer) setMissing(refs references) {
+	if ex == nil {
+		return
+	}
+	ex.missing = refs
+}
+
+// setSource records where the candidate importPath was found, unless
+// already known.
+func (ex *explainer) setSource(importPath string, src CandidateSource) {
+	if ex == nil {
+		return
+	}
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	if ex.sources == nil {
+		ex.sources = map[string]CandidateSource{}
+	}
+	if _, ok := ex.sources[importPath]; !ok {
+		ex.sources[importPath] = src
+	}
+}
+
+// startFix forgets the candidates matched by previous calls to fix.
+func (ex *explainer) startFix() {
+	if ex == nil {
+		return
+	}
+	ex.matched = map[string][]*Candidate{}
+}
+
+// match records the candidate imp for the identifier pkg, given found, the
+// candidate chosen before it, if any.
+func (ex *explainer) match(pkg string, imp *ImportInfo, info *packageInfo, syms map[string]bool, found *ImportInfo) {
+	for _, c := range ex.matched[pkg] {
+		if c.ImportPath == imp.ImportPath {
+			return
+		}
+	}
+	c := &Candidate{
+		ImportPath: imp.ImportPath,
+		Source:     SourceSibling,
+		Distance:   -1,
+	}
+	if src, ok := ex.sources[imp.ImportPath]; ok {
+		c.Source = src
+	}
+	if c.Source == SourceStdlib {
+		c.Relevance = MaxRelevance
+	}
+	if reason := missingReason(info.exports, syms); reason != "" {
+		c.Rejected = reason
+	} else if found != nil {
+		c.Rejected = fmt.Sprintf("%s comes first", found.ImportPath)
+	}
+	ex.matched[pkg] = append(ex.matched[pkg], c)
+}
+
+// consider records the candidates found for the identifier pkgName by
+// scanning, in the order findImport considers them.
+func (ex *explainer) consider(pkgName string, candidates []pkgDistance, modules bool) {
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	for _, c := range candidates {
+		ex.addScanned(pkgName, &Candidate{
+			ImportPath: c.pkg.importPathShort,
+			Source:     SourceScan,
+			Dir:        c.pkg.dir,
+			Distance:   c.distance,
+			Relevance:  c.pkg.relevance,
+			OutOfScope: modules && c.pkg.relevance == OutOfScopeRelevance,
+		})
+	}
+}
+
+func (ex *explainer) addScanned(pkgName string, c *Candidate) {
+	if ex.scanned == nil {
+		ex.scanned = map[string][]*Candidate{}
+	}
+	ex.scanned[pkgName] = append(ex.scanned[pkgName], c)
+}
+
+// reject records why the package p, at the given distance from the file,
+// can't provide the identifier pkgName.
+func (ex *explainer) reject(pkgName string, p *pkg, distance int, reason string) {
+	if ex == nil {
+		return
+	}
+	ex.mu.Lock()
+	defer ex.mu.Unlock()
+	for _, c := range ex.scanned[pkgName] {
+		if c.ImportPath == p.importPathShort && c.Dir == p.dir {
+			c.Rejected = reason
+			return
+		}
+	}
+	ex.addScanned(pkgName, &Candidate{
+		ImportPath: p.importPathShort,
+		Source:     SourceScan,
+		Dir:        p.dir,
+		Distance:   distance,
+		Relevance:  p.relevance,
+		Rejected:   reason,
+	})
+}
+
+// rejectByPath records why p can't provide the identifiers of refs that its
+// import path suggests it might.
+func (ex *explainer) rejectByPath(refs references, p *pkg, reason string) {
+	if ex == nil {
+		return
+	}
+	for pkgName := range refs {
+		if pathMayProvide(p, pkgName) {
+			ex.reject(pkgName, p, -1, reason)
+		}
+	}
+}
+
+// missingReason returns the reason a package with exports can't provide
+// syms, or "" if it can.
+func missingReason(exports, syms map[string]bool) string {
+	var missing []string
+	for sym := range syms {
+		if !exports[sym] {
+			missing = append(missing, sym)
+		}
+	}
+	if len(missing) == 0 {
+		return ""
+	}
+	sort.Strings(missing)
+	return "does not export " + strings.Join(missing, ", ")
+}
+
+// explanation returns the explanation of fixes.
+func (ex *explainer) explanation(fixes []*ImportFix) *Explanation {
+	res := &Explanation{}
+
+	chosen := map[string]string{}
+	for _, fix := range fixes {
+		var reason string
+		switch fix.FixType {
+		case AddImport:
+			chosen[fix.IdentName] = fix.StmtInfo.ImportPath
+			var refs []string
+			for sym := range ex.missing[fix.IdentName] {
+				refs = append(refs, fix.IdentName+"."+sym)
+			}
+			sort.Strings(refs)
+			reason = "provides " + strings.Join(refs, ", ")
+		case DeleteImport:
+			reason = fmt.Sprintf("%s is not used", fix.IdentName)
+		case SetImportName:
+			switch fix.StmtInfo.Name {
+			case "":
+				reason = fmt.Sprintf("the name %s is the package name already", fix.IdentName)
+			case fix.IdentName:
+				reason = fmt.Sprintf("the package name %s differs from %s, the name implied by the import path", fix.IdentName, ImportPathToAssumedName(fix.StmtInfo.ImportPath))
+			default:
+				reason = fmt.Sprintf("the alias policy names the package %s", fix.StmtInfo.Name)
+			}
+		case AliasConflict:
+			reason = fmt.Sprintf("the alias policy names the package %s, which the file uses for something else", fix.StmtInfo.Name)
+		}
+		res.Fixes = append(res.Fixes, &ExplainedFix{Fix: fix, Reason: reason})
+	}
+	sort.Slice(res.Fixes, func(i, j int) bool {
+		fi, fj := res.Fixes[i].Fix, res.Fixes[j].Fix
+		if fi.FixType != fj.FixType {
+			return fi.FixType < fj.FixType
+		}
+		return fi.StmtInfo.ImportPath < fj.StmtInfo.ImportPath
+	})
+
+	for name, syms := range ex.missing {
+		ref := &RefExplanation{Name: name, Chosen: chosen[name]}
+		for sym := range syms {
+			ref.Symbols = append(ref.Symbols, sym)
+		}
+		sort.Strings(ref.Symbols)
+
+		seen := map[string]*Candidate{}
+		for _, c := range ex.matched[name] {
+			seen[c.ImportPath] = c
+			ref.Candidates = append(ref.Candidates, c)
+		}
+		for _, c := range ex.scanned[name] {
+			if m, ok := seen[c.ImportPath]; ok {
+				// The winner of the scan, matched again by fix.
+				if m.Source == SourceScan && m.Dir == "" {
+					m.Dir, m.Distance, m.Relevance, m.OutOfScope = c.Dir, c.Distance, c.Relevance, c.OutOfScope
+				}
+				continue
+			}
+			ref.Candidates = append(ref.Candidates, c)
+		}
+		res.Refs = append(res.Refs, ref)
+	}
+	sort.Slice(res.Refs, func(i, j int) bool { return res.Refs[i].Name < res.Refs[j].Name })
+	return res
+}
@@ -30,50 +30,17 @@ import (
 	"golang.org/x/tools/go/ast/astutil"
 )
 
-// importToGroup is a list of functions which map from an import path to
-// a group number.
-var importToGroup = []func(localPrefix, importPath string) (num int, ok bool){
-	func(localPrefix, importPath string) (num int, ok bool) {
-		if localPrefix == "" {
-			return
-		}
-		for _, p := range strings.Split(localPrefix, ",") {
-			if strings.HasPrefix(importPath, p) || strings.TrimSuffix(p, "/") == importPath {
-				return 3, true
-			}
-		}
-		return
-	},
-	func(_, importPath string) (num int, ok bool) {
-		if strings.HasPrefix(importPath, "appengine") {
-			return 2, true
-		}
-		return
-	},
-	func(_, importPath string) (num int, ok bool) {
-		firstComponent := strings.Split(importPath, "/")[0]
-		if strings.Contains(firstComponent, ".") {
-			return 1, true
-		}
-		return
-	},
-}
-
-func importGroup(localPrefix, importPath string) int {
-	for _, fn := range importToGroup {
-		if n, ok := fn(localPrefix, importPath); ok {
-			return n
-		}
-	}
-	return 0
-}
-
 type ImportFixType int
 
 const (
 	AddImport ImportFixType = iota
 	DeleteImport
 	SetImportName
+
+	// AliasConflict reports an import that can't be given the name
+	// Options.Aliases requires, in StmtInfo.Name, because the file uses
+	// that name for something else. It changes nothing.
+	AliasConflict
 )
 
 type ImportFix struct {
@@ -81,11 +48,28 @@ type ImportFix struct {
 	StmtInfo ImportInfo
 	// IdentName is the identifier that this fix will add or remove.
 	IdentName string
-	// FixType is the type of fix this is (AddImport, DeleteImport, SetImportName).
+	// FixType is the type of fix this is (AddImport, DeleteImport, SetImportName, AliasConflict).
 	FixType   ImportFixType
 	Relevance float64 // see pkg
 }
 
+// RenamesReferences reports whether applying f renames the references of
+// the file to the package, because the import is added or renamed under a
+// name other than IdentName.
+func (f *ImportFix) RenamesReferences() bool {
+	switch f.FixType {
+	case AddImport:
+		return f.IdentName != "" && f.StmtInfo.Name != "" && f.StmtInfo.Name != f.IdentName
+	case SetImportName:
+		ident := f.StmtInfo.Name
+		if ident == "" {
+			ident = ImportPathToAssumedName(f.StmtInfo.ImportPath)
+		}
+		return f.IdentName != "" && ident != f.IdentName
+	}
+	return false
+}
+
 // An ImportInfo represents a single import statement.
 type ImportInfo struct {
 	ImportPath string // import path, e.g. "crypto/rand".
@@ -99,28 +83,47 @@ type packageInfo struct {
 }
 
 // parseOtherFiles parses all the Go files in srcDir except filename, including
-// test files if filename looks like a test.
-func parseOtherFiles(fset *token.FileSet, srcDir, filename string) []*ast.File {
+// test files if filename looks like a test. Files in overlay, keyed by
+// absolute path, are parsed from there rather than from disk, and may not
+// exist on disk.
+func parseOtherFiles(fset *token.FileSet, srcDir, filename string, overlay map[string][]byte) []*ast.File {
 	// This could use go/packages but it doesn't buy much, and it fails
 	// with https://golang.org/issue/26296 in LoadFiles mode in some cases.
 	considerTests := strings.HasSuffix(filename, "_test.go")
 
 	fileBase := filepath.Base(filename)
 	packageFileInfos, err := os.ReadDir(srcDir)
-	if err != nil {
+	if err != nil && len(overlay) == 0 {
 		return nil
 	}
+	var names []string
+	seen := map[string]bool{}
+	for _, fi := range packageFileInfos {
+		names = append(names, fi.Name())
+		seen[fi.Name()] = true
+	}
+	for path := range overlay {
+		if name := filepath.Base(path); filepath.Dir(path) == srcDir && !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
 
 	var files []*ast.File
-	for _, fi := range packageFileInfos {
-		if fi.Name() == fileBase || !strings.HasSuffix(fi.Name(), ".go") {
+	for _, name := range names {
+		if name == fileBase || !strings.HasSuffix(name, ".go") {
 			continue
 		}
-		if !considerTests && strings.HasSuffix(fi.Name(), "_test.go") {
+		if !considerTests && strings.HasSuffix(name, "_test.go") {
 			continue
 		}
 
-		f, err := parser.ParseFile(fset, filepath.Join(srcDir, fi.Name()), nil, 0)
+		path := filepath.Join(srcDir, name)
+		var src interface{}
+		if data, ok := overlay[path]; ok {
+			src = data
+		}
+		f, err := parser.ParseFile(fset, path, src, 0)
 		if err != nil {
 			continue
 		}
@@ -211,6 +214,7 @@ func collectImports(f *ast.File) []*ImportInfo {
 // findMissingImport searches pass's candidates for an import that provides
 // pkg, containing all of syms.
 func (p *pass) findMissingImport(pkg string, syms map[string]bool) *ImportInfo {
+	var found *ImportInfo
 	for _, candidate := range p.candidates {
 		pkgInfo, ok := p.knownPackages[candidate.ImportPath]
 		if !ok {
@@ -228,11 +232,19 @@ func (p *pass) findMissingImport(pkg string, syms map[string]bool) *ImportInfo {
 			}
 		}
 
+		if p.explain != nil {
+			// Keep going to explain why the remaining candidates lose.
+			p.explain.match(pkg, candidate, pkgInfo, syms, found)
+			if allFound && found == nil {
+				found = candidate
+			}
+			continue
+		}
 		if allFound {
 			return candidate
 		}
 	}
-	return nil
+	return found
 }
 
 // references is set of references found in a Go file. The first map key is the
@@ -250,6 +262,7 @@ type pass struct {
 	env                  *ProcessEnv    // the environment to use for go commands, etc.
 	loadRealPackageNames bool           // if true, load package names from disk rather than guessing them.
 	otherFiles           []*ast.File    // sibling files.
+	aliases              *aliasPolicy   // how imports must be named, or nil.
 
 	// Intermediate state, generated by load.
 	existingImports map[string]*ImportInfo
@@ -260,6 +273,8 @@ type pass struct {
 	lastTry       bool                    // indicates that this is the last call and fix should clean up as best it can.
 	candidates    []*ImportInfo           // candidate imports in priority order.
 	knownPackages map[string]*packageInfo // information about all known packages.
+
+	explain *explainer // if non-nil, records the decisions made; see Explain.
 }
 
 // loadPackageNames saves the package names for everything referenced by imports.
@@ -362,6 +377,7 @@ func (p *pass) load() ([]*ImportFix, bool) {
 			continue
 		}
 	}
+	p.explain.setMissing(p.missingRefs)
 	if len(p.missingRefs) != 0 {
 		return nil, false
 	}
@@ -374,6 +390,7 @@ func (p *pass) load() ([]*ImportFix, bool) {
 // delete anything unused, and update import names, and returns true.
 func (p *pass) fix() ([]*ImportFix, bool) {
 	// Find missing imports.
+	p.explain.startFix()
 	var selected []*ImportInfo
 	for left, rights := range p.missingRefs {
 		if imp := p.findMissingImport(left, rights); imp != nil {
@@ -386,7 +403,11 @@ func (p *pass) fix() ([]*ImportFix, bool) {
 	}
 
 	// Found everything, or giving up. Add the new imports and remove any unused.
+	if p.aliases != nil && p.aliases.removeRedundant {
+		p.loadNamedPackageNames()
+	}
 	var fixes []*ImportFix
+	taken := map[string]bool{} // the names required by the alias policy
 	for _, imp := range p.existingImports {
 		// We deliberately ignore globals here, because we can't be sure
 		// they're in the same package. People do things like put multiple
@@ -403,7 +424,11 @@ func (p *pass) fix() ([]*ImportFix, bool) {
 		}
 
 		// An existing import may need to update its import name to be correct.
-		if name := p.importSpecName(imp); name != imp.Name {
+		name, conflict := p.policyName(imp, p.importSpecName(imp), taken)
+		if conflict != nil {
+			fixes = append(fixes, conflict)
+		}
+		if name != imp.Name {
 			fixes = append(fixes, &ImportFix{
 				StmtInfo: ImportInfo{
 					Name:       name,
@@ -416,9 +441,13 @@ func (p *pass) fix() ([]*ImportFix, bool) {
 	}
 
 	for _, imp := range selected {
+		name, conflict := p.policyName(imp, p.importSpecName(imp), taken)
+		if conflict != nil {
+			fixes = append(fixes, conflict)
+		}
 		fixes = append(fixes, &ImportFix{
 			StmtInfo: ImportInfo{
-				Name:       p.importSpecName(imp),
+				Name:       name,
 				ImportPath: imp.ImportPath,
 			},
 			IdentName: p.importIdentifier(imp),
@@ -447,7 +476,8 @@ func (p *pass) importSpecName(imp *ImportInfo) string {
 	return ident
 }
 
-// apply will perform the fixes on f in order.
+// apply will perform the fixes on f in order. The references to imports
+// added or renamed under a name other than IdentName are renamed too.
 func apply(fset *token.FileSet, f *ast.File, fixes []*ImportFix) {
 	for _, fix := range fixes {
 		switch fix.FixType {
@@ -455,17 +485,30 @@ func apply(fset *token.FileSet, f *ast.File, fixes []*ImportFix) {
 			astutil.DeleteNamedImport(fset, f, fix.StmtInfo.Name, fix.StmtInfo.ImportPath)
 		case AddImport:
 			astutil.AddNamedImport(fset, f, fix.StmtInfo.Name, fix.StmtInfo.ImportPath)
+			renameReferences(f, fix.IdentName, fix.StmtInfo.Name)
 		case SetImportName:
 			// Find the matching import path and change the name.
 			for _, spec := range f.Imports {
 				path := strings.Trim(spec.Path.Value, `"`)
-				if path == fix.StmtInfo.ImportPath {
-					spec.Name = &ast.Ident{
-						Name:    fix.StmtInfo.Name,
-						NamePos: spec.Pos(),
-					}
+				if path != fix.StmtInfo.ImportPath || importName(spec) == "_" || importName(spec) == "." {
+					continue
+				}
+				if fix.StmtInfo.Name == "" {
+					spec.Name = nil
+					continue
 				}
+				spec.Name = &ast.Ident{
+					Name:    fix.StmtInfo.Name,
+					NamePos: spec.Pos(),
+				}
+			}
+			// Unnamed imports are only left to those whose package name
+			// is the one implied by the import path.
+			ident := fix.StmtInfo.Name
+			if ident == "" {
+				ident = ImportPathToAssumedName(fix.StmtInfo.ImportPath)
 			}
+			renameReferences(f, fix.IdentName, ident)
 		}
 	}
 }
@@ -482,6 +525,7 @@ func (p *pass) assumeSiblingImportsValid() {
 		}
 		for left, rights := range refs {
 			if imp, ok := importsByName[left]; ok {
+				p.explain.setSource(imp.ImportPath, SourceSibling)
 				if m, ok := stdlib[imp.ImportPath]; ok {
 					// We have the stdlib in memory; no need to guess.
 					rights = copyExports(m)
@@ -512,24 +556,28 @@ func (p *pass) addCandidate(imp *ImportInfo, pkg *packageInfo) {
 }
 
 // fixImports adds and removes imports from f so that all its references are
-// satisfied and there are no unused imports.
+// satisfied and there are no unused imports, and returns the fixes it applied.
+// If aliases is non-nil, the imports are named as it requires.
 //
 // This is declared as a variable rather than a function so gosimports can
 // easily be extended by adding a file with an init function.
 var fixImports = fixImportsDefault
 
-func fixImportsDefault(fset *token.FileSet, f *ast.File, filename string, env *ProcessEnv) error {
-	fixes, err := getFixes(fset, f, filename, env)
+func fixImportsDefault(fset *token.FileSet, f *ast.File, filename string, env *ProcessEnv, overlay map[string][]byte, aliases *aliasPolicy) ([]*ImportFix, error) {
+	fixes, err := getFixes(fset, f, filename, env, overlay, aliases, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	apply(fset, f, fixes)
-	return err
+	return fixes, nil
 }
 
 // getFixes gets the import fixes that need to be made to f in order to fix the imports.
-// It does not modify the ast.
-func getFixes(fset *token.FileSet, f *ast.File, filename string, env *ProcessEnv) ([]*ImportFix, error) {
+// It does not modify the ast. The files of the package in overlay are read
+// from there rather than from disk. If aliases is non-nil, the fixes name
+// the imports as it requires. If ex is non-nil, it records the decisions
+// made.
+func getFixes(fset *token.FileSet, f *ast.File, filename string, env *ProcessEnv, overlay map[string][]byte, aliases *aliasPolicy, ex *explainer) ([]*ImportFix, error) {
 	abs, err := filepath.Abs(filename)
 	if err != nil {
 		return nil, err
@@ -539,16 +587,28 @@ func getFixes(fset *token.FileSet, f *ast.File, filename string, env *ProcessEnv
 		env.Logf("fixImports(filename=%q), abs=%q, srcDir=%q ...", filename, abs, srcDir)
 	}
 
+	var otherFiles []*ast.File
+	if aliases != nil && len(aliases.aliases) > 0 {
+		// The names the alias policy requires must not clash with the
+		// declarations of the other files.
+		otherFiles = parseOtherFiles(fset, srcDir, filename, overlay)
+		policy := *aliases
+		policy.declared = packageLevelNames(otherFiles, f.Name.Name)
+		aliases = &policy
+	}
+
 	// First pass: looking only at f, and using the naive algorithm to
 	// derive package names from import paths, see if the file is already
 	// complete. We can't add any imports yet, because we don't know
 	// if missing references are actually package vars.
-	p := &pass{fset: fset, f: f, srcDir: srcDir, env: env}
+	p := &pass{fset: fset, f: f, srcDir: srcDir, env: env, aliases: aliases, explain: ex}
 	if fixes, done := p.load(); done {
 		return fixes, nil
 	}
 
-	otherFiles := parseOtherFiles(fset, srcDir, filename)
+	if otherFiles == nil {
+		otherFiles = parseOtherFiles(fset, srcDir, filename, overlay)
+	}
 
 	// Second pass: add information from other files in the same package,
 	// like their package vars and imports.
@@ -559,6 +619,7 @@ func getFixes(fset *token.FileSet, f *ast.File, filename string, env *ProcessEnv
 
 	// Now we can try adding imports from the stdlib.
 	p.assumeSiblingImportsValid()
+	p.assumeAliasesValid()
 	_ = addStdlibCandidates(p, p.missingRefs)
 	if fixes, done := p.fix(); done {
 		return fixes, nil
@@ -566,7 +627,7 @@ func getFixes(fset *token.FileSet, f *ast.File, filename string, env *ProcessEnv
 
 	// Third pass: get real package names where we had previously used
 	// the naive algorithm.
-	p = &pass{fset: fset, f: f, srcDir: srcDir, env: env}
+	p = &pass{fset: fset, f: f, srcDir: srcDir, env: env, aliases: aliases, explain: ex}
 	p.loadRealPackageNames = true
 	p.otherFiles = otherFiles
 	if fixes, done := p.load(); done {
@@ -577,6 +638,7 @@ func getFixes(fset *token.FileSet, f *ast.File, filename string, env *ProcessEnv
 		return nil, err
 	}
 	p.assumeSiblingImportsValid()
+	p.assumeAliasesValid()
 	if fixes, done := p.fix(); done {
 		return fixes, nil
 	}
@@ -738,6 +800,9 @@ type ProcessEnv struct {
 	// If Logf is non-nil, debug logging is enabled through this function.
 	Logf func(format string, args ...interface{})
 
+	// mu guards initialized, the population of Env by init, and resolver,
+	// so that a single ProcessEnv may be shared by concurrent Process calls.
+	mu          sync.Mutex
 	initialized bool
 
 	resolver Resolver
@@ -760,6 +825,8 @@ func (e *ProcessEnv) matchFile(dir, name string) (bool, error) {
 
 // CopyConfig copies the env's configuration into a new env.
 func (e *ProcessEnv) CopyConfig() *ProcessEnv {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	copy := &ProcessEnv{
 		GocmdRunner: e.GocmdRunner,
 		initialized: e.initialized,
@@ -776,6 +843,13 @@ func (e *ProcessEnv) CopyConfig() *ProcessEnv {
 }
 
 func (e *ProcessEnv) init() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.initLocked()
+}
+
+// initLocked is like init, but requires e.mu to be held.
+func (e *ProcessEnv) initLocked() error {
 	if e.initialized {
 		return nil
 	}
@@ -820,10 +894,12 @@ func (e *ProcessEnv) env() []string {
 }
 
 func (e *ProcessEnv) GetResolver() (Resolver, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	if e.resolver != nil {
 		return e.resolver, nil
 	}
-	if err := e.init(); err != nil {
+	if err := e.initLocked(); err != nil {
 		return nil, err
 	}
 	if len(e.Env["GOMOD"]) == 0 && len(e.Env["GOWORK"]) == 0 {
@@ -903,6 +979,7 @@ func addStdlibCandidates(pass *pass, refs references) error {
 			return
 		}
 		exports := copyExports(stdlib[pkg])
+		pass.explain.setSource(pkg, SourceStdlib)
 		pass.addCandidate(
 			&ImportInfo{ImportPath: pkg},
 			&packageInfo{name: path.Base(pkg), exports: exports})
@@ -961,15 +1038,20 @@ func addExternalCandidates(pass *pass, refs references, filename string) error {
 			return true // We want everything.
 		},
 		dirFound: func(pkg *pkg) bool {
+			if pass.explain != nil && !canUse(filename, pkg.dir) {
+				pass.explain.rejectByPath(refs, pkg, "not visible from the file: internal or vendor package")
+			}
 			return pkgIsCandidate(filename, refs, pkg)
 		},
 		packageNameLoaded: func(pkg *pkg) bool {
 			if _, want := refs[pkg.packageName]; !want {
+				pass.explain.rejectByPath(refs, pkg, fmt.Sprintf("package name is %s", pkg.packageName))
 				return false
 			}
 			if pkg.dir == pass.srcDir && pass.f.Name.Name == pkg.packageName {
 				// The candidate is in the same directory and has the
 				// same package name. Don't try to import ourselves.
+				pass.explain.reject(pkg.packageName, pkg, -1, "is the package of the file itself")
 				return false
 			}
 			if !canUse(filename, pkg.dir) {
@@ -1042,6 +1124,7 @@ func addExternalCandidates(pass *pass, refs references, filename string) error {
 	}()
 
 	for result := range results {
+		pass.explain.setSource(result.imp.ImportPath, SourceScan)
 		pass.addCandidate(result.imp, result.pkg)
 	}
 	return firstErr
@@ -1434,6 +1517,10 @@ func findImport(ctx context.Context, pass *pass, candidates []pkgDistance, pkgNa
 	if err != nil {
 		return nil, err
 	}
+	if pass.explain != nil {
+		_, modules := resolver.(*ModuleResolver)
+		pass.explain.consider(pkgName, candidates, modules)
+	}
 
 	// Collect exports for packages with matching names.
 	rescv := make([]chan *pkg, len(candidates))
@@ -1477,6 +1564,7 @@ func findImport(ctx context.Context, pass *pass, candidates []pkgDistance, pkgNa
 					if pass.env.Logf != nil {
 						pass.env.Logf("loading exports in dir %s (seeking package %s): %v", c.pkg.dir, pkgName, err)
 					}
+					pass.explain.reject(pkgName, c.pkg, c.distance, fmt.Sprintf("loading exports: %v", err))
 					resc <- nil
 					return
 				}
@@ -1490,6 +1578,7 @@ func findImport(ctx context.Context, pass *pass, candidates []pkgDistance, pkgNa
 				// symbols, send nil to mean no match.
 				for symbol := range symbols {
 					if !exportsMap[symbol] {
+						pass.explain.reject(pkgName, c.pkg, c.distance, missingReason(exportsMap, symbols))
 						resc <- nil
 						return
 					}
@@ -1499,14 +1588,23 @@ func findImport(ctx context.Context, pass *pass, candidates []pkgDistance, pkgNa
 		}
 	}()
 
-	for _, resc := range rescv {
+	var found *pkg
+	for i, resc := range rescv {
 		pkg := <-resc
 		if pkg == nil {
 			continue
 		}
-		return pkg, nil
+		if pass.explain == nil {
+			return pkg, nil
+		}
+		// Wait for all candidates to explain why the others lose.
+		if found == nil {
+			found = pkg
+		} else {
+			pass.explain.reject(pkgName, pkg, candidates[i].distance, fmt.Sprintf("%s is closer to the file or has a shorter import path", found.importPathShort))
+		}
 	}
-	return nil, nil
+	return found, nil
 }
 
 // pkgIsCandidate reports whether pkg is a candidate for satisfying the
@@ -1540,15 +1638,24 @@ func pkgIsCandidate(filename string, refs references, pkg *pkg) bool {
 	// anyway. There's no reason gosimports needs
 	// to be slow just to accommodate that.
 	for pkgIdent := range refs {
-		lastTwo := lastTwoComponents(pkg.importPathShort)
-		if strings.Contains(lastTwo, pkgIdent) {
+		if pathMayProvide(pkg, pkgIdent) {
 			return true
 		}
-		if hasHyphenOrUpperASCII(lastTwo) && !hasHyphenOrUpperASCII(pkgIdent) {
-			lastTwo = lowerASCIIAndRemoveHyphen(lastTwo)
-			if strings.Contains(lastTwo, pkgIdent) {
-				return true
-			}
+	}
+	return false
+}
+
+// pathMayProvide reports whether the last two components of the import path
+// of pkg contain pkgIdent, as pkgIsCandidate requires.
+func pathMayProvide(pkg *pkg, pkgIdent string) bool {
+	lastTwo := lastTwoComponents(pkg.importPathShort)
+	if strings.Contains(lastTwo, pkgIdent) {
+		return true
+	}
+	if hasHyphenOrUpperASCII(lastTwo) && !hasHyphenOrUpperASCII(pkgIdent) {
+		lastTwo = lowerASCIIAndRemoveHyphen(lastTwo)
+		if strings.Contains(lastTwo, pkgIdent) {
+			return true
 		}
 	}
 	return false
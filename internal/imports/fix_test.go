@@ -11,6 +11,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -374,6 +375,59 @@ import (
 func f() {
 	fmt.Println("Hello, world")
 }
+`,
+	},
+	{
+		name: "cgo_in_mixed_import_block",
+		in: `package foo
+
+import (
+	"github.com/foo/bar"
+	// #include <stdlib.h>
+	"C" // cgo
+	"fmt"
+	"unsafe"
+)
+
+var _, _, _, _ = bar.X, C.malloc, fmt.Println, unsafe.Pointer(nil)
+`,
+		out: `package foo
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/foo/bar"
+)
+
+// #include <stdlib.h>
+import "C" // cgo
+
+var _, _, _, _ = bar.X, C.malloc, fmt.Println, unsafe.Pointer(nil)
+`,
+	},
+	{
+		name: "cgo_without_preamble_in_mixed_import_block",
+		in: `package foo
+
+import (
+	"os"
+	"C"
+	"fmt"
+)
+
+var _, _, _ = C.int, fmt.Println, os.Exit
+`,
+		out: `package foo
+
+import (
+	"fmt"
+	"os"
+)
+
+import "C"
+
+var _, _, _ = C.int, fmt.Println, os.Exit
 `,
 	},
 
@@ -919,6 +973,219 @@ func something() {
 `,
 	},
 
+	// Comments inside import blocks are kept with the imports they precede.
+	{
+		name: "comments_kept_when_regrouping",
+		in: `package foo
+
+import (
+	"bufio"
+
+	// basic comments
+
+	/*
+		block comments
+	*/
+
+	"github.com/foo/imports"
+
+	"errors"
+	// doc for gocmd
+	gocmd "github.com/foo/gocommand"
+	"flag"
+	_ "runtime/pprof" // trailing inline comments
+	// dangling comment
+)
+
+// doc for the second declaration
+import "strings"
+
+var _, _, _, _, _, _ = bufio.NewReader, imports.X, errors.New, gocmd.X, flag.Parse, strings.Cut
+`,
+		out: `package foo
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	_ "runtime/pprof" // trailing inline comments
+	// doc for the second declaration
+	"strings"
+
+	// doc for gocmd
+	gocmd "github.com/foo/gocommand"
+	// basic comments
+	/*
+		block comments
+	*/
+	"github.com/foo/imports"
+	// dangling comment
+)
+
+var _, _, _, _, _, _ = bufio.NewReader, imports.X, errors.New, gocmd.X, flag.Parse, strings.Cut
+`,
+	},
+
+	// Comments after the last import stay after the last import.
+	{
+		name: "comment_after_last_import",
+		in: `package foo
+
+import (
+	"os"
+	"fmt" // trailing
+	// floating at end
+)
+
+var _, _ = fmt.Println, os.Exit
+`,
+		out: `package foo
+
+import (
+	"fmt" // trailing
+	"os"
+	// floating at end
+)
+
+var _, _ = fmt.Println, os.Exit
+`,
+	},
+
+	// Comments of removed imports attach to the next import.
+	{
+		name: "comments_of_removed_import",
+		in: `package foo
+
+import (
+	"fmt"
+
+	// floating comment
+
+	"os"
+	"strings"
+)
+
+var _, _ = fmt.Println, strings.Cut
+`,
+		out: `package foo
+
+import (
+	"fmt"
+	// floating comment
+	"strings"
+)
+
+var _, _ = fmt.Println, strings.Cut
+`,
+	},
+
+	// The import block is found by parsing, not by scanning lines.
+	{
+		name: "block_comment_with_right_paren",
+		in: `package foo
+
+import (
+	"fmt"
+	"os" /* see ) */
+	/* see ) below */
+	"errors"
+)
+
+var _, _, _ = errors.New, fmt.Println, os.Exit
+`,
+		out: `package foo
+
+import (
+	/* see ) below */
+	"errors"
+	"fmt"
+	"os" /* see ) */
+)
+
+var _, _, _ = errors.New, fmt.Println, os.Exit
+`,
+	},
+	{
+		name: "import_path_with_right_paren",
+		in: `package foo
+
+import (
+	ab "example.com/a)b"
+	"fmt"
+)
+
+var _, _ = fmt.Println, ab.X
+`,
+		out: `package foo
+
+import (
+	"fmt"
+
+	ab "example.com/a)b"
+)
+
+var _, _ = fmt.Println, ab.X
+`,
+	},
+	{
+		name: "import_paren_in_package_comment",
+		in: `/*
+import (
+*/
+package foo
+
+import (
+	"os"
+	"fmt"
+)
+
+var _, _ = fmt.Println, os.Exit
+`,
+		out: `/*
+import (
+*/
+package foo
+
+import (
+	"fmt"
+	"os"
+)
+
+var _, _ = fmt.Println, os.Exit
+`,
+	},
+	{
+		name: "second_parenthesized_import_decl",
+		in: `package foo
+
+// #include <stdlib.h>
+import (
+	"C"
+)
+
+import (
+	"os"
+	"fmt"
+)
+
+var _, _, _ = C.malloc, fmt.Println, os.Exit
+`,
+		out: `package foo
+
+// #include <stdlib.h>
+import (
+	"C"
+)
+
+import (
+	"fmt"
+	"os"
+)
+
+var _, _, _ = C.malloc, fmt.Println, os.Exit
+`,
+	},
+
 	// FormatOnly
 	{
 		name:       "formatonly_works",
@@ -2379,6 +2646,41 @@ var _ = fmt.Printf
 
 }
 
+// Tests that the siblings in Options.Overlay are used instead of the files
+// on disk, and that they need not exist on disk.
+func TestSiblingImport_Overlay(t *testing.T) {
+	const onDisk = `package pkg
+import renamed "fmt"
+var _ = renamed.Printf
+`
+	const input = `package pkg
+var _ = renamed.ToUpper(log)
+`
+	const want = `package pkg
+
+import renamed "strings"
+
+var _ = renamed.ToUpper(log)
+`
+
+	testConfig{
+		module: packagestest.Module{
+			Name: "foo.com",
+			Files: fm{
+				"pkg/sibling.go": onDisk,
+				"pkg/uses.go":    input,
+			},
+		},
+	}.test(t, func(t *goimportTest) {
+		dir := filepath.Dir(t.exported.File("foo.com", "pkg/uses.go"))
+		opts := &Options{Comments: true, TabIndent: true, TabWidth: 8, Overlay: map[string][]byte{
+			filepath.Join(dir, "sibling.go"): []byte("package pkg\nimport renamed \"strings\"\nvar _ = renamed.ToLower\n"),
+			filepath.Join(dir, "new.go"):     []byte("package pkg\nvar log = \"x\"\n"),
+		}}
+		t.assertProcessEquals("foo.com", "pkg/uses.go", nil, opts, want)
+	})
+}
+
 // Tests that an input file's own package is ignored.
 func TestIgnoreOwnPackage(t *testing.T) {
 	const input = `package pkg
@@ -2833,3 +3135,132 @@ var _, _ = fmt.Sprintf, dot.Dot
 		gopathOnly: true, // our modules testing setup doesn't allow modules without dots.
 	}.processTest(t, "golang.org/fake", "x.go", nil, nil, want)
 }
+
+func TestGeneratedPolicy(t *testing.T) {
+	const input = `// Code generated by foo. DO NOT EDIT.
+
+package p
+
+import (
+"os"
+)
+
+var _ = fmt.Sprintf
+`
+	tests := []struct {
+		policy GeneratedPolicy
+		want   string
+	}{
+		{GeneratedFull, `// Code generated by foo. DO NOT EDIT.
+
+package p
+
+import "fmt"
+
+var _ = fmt.Sprintf
+`},
+		{GeneratedFormatOnly, `// Code generated by foo. DO NOT EDIT.
+
+package p
+
+import (
+	"os"
+)
+
+var _ = fmt.Sprintf
+`},
+		{GeneratedSkip, input},
+	}
+	for _, tt := range tests {
+		opts := &Options{Comments: true, TabIndent: true, TabWidth: 8, Generated: tt.policy}
+		testConfig{
+			module: packagestest.Module{
+				Name:  "foo.com",
+				Files: fm{"p/x.go": input},
+			},
+		}.processTest(t, "foo.com", "p/x.go", nil, opts, tt.want)
+	}
+}
+
+func TestIsGenerated(t *testing.T) {
+	for src, want := range map[string]bool{
+		"// Code generated by foo. DO NOT EDIT.\npackage p\n":                   true,
+		"// Copyright\n\n// Code generated by foo. DO NOT EDIT.\r\npackage p\n": true,
+		"/* Code generated by foo. DO NOT EDIT. */\npackage p\n":                false,
+		"// Code generated DO NOT EDIT.\npackage p\n":                           false,
+		"// Code generated by foo. DO NOT EDIT\npackage p\n":                    false,
+		"package p\n\n// Code generated by foo. DO NOT EDIT.\n":                 false,
+	} {
+		if got := isGenerated([]byte(src)); got != want {
+			t.Errorf("isGenerated(%q) = %v, want %v", src, got, want)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	const input = `package main
+
+import "os"
+
+func main() {
+	rand.Foo()
+	fmt.Println(rand.Int())
+}
+`
+	testConfig{
+		module: packagestest.Module{
+			Name: "foo.com",
+			Files: fm{
+				"app/x.go":             input,
+				"lib/rand/r.go":        "package rand\nfunc Foo() {}\nfunc Int() int { return 0 }\n",
+				"lib2/rand/r.go":       "package rand\nfunc Foo() {}\nfunc Int() int { return 0 }\n",
+				"short/rand/r.go":      "package rand\nfunc Foo() {}\n",
+				"x/internal/rand/r.go": "package rand\nfunc Foo() {}\nfunc Int() int { return 0 }\n",
+			},
+		},
+	}.test(t, func(t *goimportTest) {
+		opts := &Options{Comments: true, TabIndent: true, TabWidth: 8, Env: t.env.CopyConfig()}
+		ex, err := Explain(t.exported.File("foo.com", "app/x.go"), []byte(input), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var fixes []string
+		for _, f := range ex.Fixes {
+			fixes = append(fixes, fmt.Sprintf("%d %s: %s", f.Fix.FixType, f.Fix.StmtInfo.ImportPath, f.Reason))
+		}
+		wantFixes := []string{
+			"0 fmt: provides fmt.Println",
+			"0 foo.com/lib/rand: provides rand.Foo, rand.Int",
+			"1 os: os is not used",
+		}
+		if !reflect.DeepEqual(fixes, wantFixes) {
+			t.Errorf("fixes = %q, want %q", fixes, wantFixes)
+		}
+
+		if len(ex.Refs) != 2 || ex.Refs[1].Name != "rand" {
+			t.Fatalf("refs = %+v, want fmt and rand", ex.Refs)
+		}
+		ref := ex.Refs[1]
+		if ref.Chosen != "foo.com/lib/rand" || !reflect.DeepEqual(ref.Symbols, []string{"Foo", "Int"}) {
+			t.Errorf("rand: chose %q for %v, want foo.com/lib/rand for [Foo Int]", ref.Chosen, ref.Symbols)
+		}
+		rejected := map[string]string{}
+		for _, c := range ref.Candidates {
+			rejected[c.ImportPath] = c.Rejected
+		}
+		for path, want := range map[string]string{
+			"crypto/rand":             "does not export Foo",
+			"foo.com/lib/rand":        "",
+			"foo.com/lib2/rand":       "foo.com/lib/rand is closer to the file or has a shorter import path",
+			"foo.com/short/rand":      "does not export Int",
+			"foo.com/x/internal/rand": "not visible from the file: internal or vendor package",
+		} {
+			if got, ok := rejected[path]; !ok {
+				t.Errorf("rand: candidate %s not considered", path)
+			} else if got != want {
+				t.Errorf("rand: candidate %s rejected with %q, want %q", path, got, want)
+			}
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package imports
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// DefaultGroups are the import groups used when Options.Groups is nil: the
+// standard library, third-party packages, App Engine packages and the
+// packages of Options.LocalPrefix. When Options.Groups is nil, the local
+// prefixes take precedence over the App Engine one, whatever their length,
+// as they did before groups were configurable.
+var DefaultGroups = []string{"std", "default", "prefix:appengine", "local"}
+
+// A Grouping assigns import paths to the groups of an import block.
+type Grouping struct {
+	groups     [][]groupMatcher // the matchers of each group
+	localFirst bool             // local matchers outrank prefix matchers
+}
+
+// groupMatcher matches import paths for a group.
+type groupMatcher struct {
+	kind   string // std, default, local, prefix, glob, regexp, blank or dot
+	prefix string // for prefix and local
+	glob   string
+	re     *regexp.Regexp
+}
+
+// The precedence of matchers matching the same import path.
+const (
+	rankDefault = iota
+	rankStd
+	rankPattern // glob and regexp
+	rankPrefix  // prefix and local
+	rankLocal   // local, if Grouping.localFirst
+	rankName    // blank and dot
+)
+
+// ParseGrouping parses the group specs of Options.Groups, with localPrefix
+// as the comma-separated prefixes of local matchers.
+//
+// Each spec describes a group, in the order they appear in import blocks,
+// as a space-separated list of matchers, any of which places an import
+// path in the group:
+//
+//	std             the standard library: paths without a dot in their first element
+//	default         the paths matched by no other group, which must appear once
+//	local           the prefixes of localPrefix
+//	prefix:P        the paths beginning with P, or equal to P without its trailing slash
+//	glob:G          the paths whose leading elements match the path.Match pattern G
+//	regexp:R        the paths containing a match of the regular expression R
+//	blank           the imports named _
+//	dot             the imports named .
+//
+// When the matchers of several groups match an import, the most specific
+// wins: blank and dot, then the longest prefix, local prefixes included,
+// then the first glob or regexp, then std.
+func ParseGrouping(specs []string, localPrefix string) (*Grouping, error) {
+	g := &Grouping{}
+	defaults := 0
+	for _, spec := range specs {
+		if strings.TrimSpace(spec) == "" {
+			return nil, fmt.Errorf("empty group")
+		}
+		var group []groupMatcher
+		for _, field := range strings.Fields(spec) {
+			kind, arg, hasArg := strings.Cut(field, ":")
+			m := groupMatcher{kind: kind}
+			switch kind {
+			case "std", "default", "blank", "dot":
+				if hasArg {
+					return nil, fmt.Errorf("group %q: %s takes no argument", spec, kind)
+				}
+				if kind == "default" {
+					defaults++
+				}
+			case "local":
+				if hasArg {
+					return nil, fmt.Errorf("group %q: local takes no argument", spec)
+				}
+				if localPrefix == "" {
+					continue
+				}
+				for _, p := range strings.Split(localPrefix, ",") {
+					group = append(group, groupMatcher{kind: kind, prefix: p})
+				}
+				continue
+			case "prefix":
+				if arg == "" {
+					return nil, fmt.Errorf("group %q: empty prefix", spec)
+				}
+				m.prefix = arg
+			case "glob":
+				if _, err := path.Match(arg, ""); err != nil || arg == "" {
+					return nil, fmt.Errorf("group %q: invalid glob %q", spec, arg)
+				}
+				m.glob = arg
+			case "regexp":
+				re, err := regexp.Compile(arg)
+				if err != nil || arg == "" {
+					return nil, fmt.Errorf("group %q: invalid regexp %q", spec, arg)
+				}
+				m.re = re
+			default:
+				return nil, fmt.Errorf("group %q: unknown matcher %q", spec, kind)
+			}
+			group = append(group, m)
+		}
+		g.groups = append(g.groups, group)
+	}
+	if defaults != 1 {
+		return nil, fmt.Errorf("groups must include default exactly once")
+	}
+	return g, nil
+}
+
+// defaultGrouping is the Grouping of DefaultGroups for localPrefix.
+func defaultGrouping(localPrefix string) *Grouping {
+	g, err := ParseGrouping(DefaultGroups, localPrefix)
+	if err != nil {
+		panic(err)
+	}
+	g.localFirst = true
+	return g
+}
+
+// LocalAuto, as one of the prefixes of Options.LocalPrefix, stands for the
+// paths of the main modules: the module of the working directory of
+// Options.Env, or the modules used by its go.work file.
+const LocalAuto = "auto"
+
+// grouping returns the Grouping of opt.Groups.
+func (opt *Options) grouping() (*Grouping, error) {
+	localPrefix, err := opt.localPrefix()
+	if err != nil {
+		return nil, err
+	}
+	if opt.Groups == nil && !opt.BlankDotGroups {
+		return defaultGrouping(localPrefix), nil
+	}
+	specs := opt.Groups
+	if specs == nil {
+		specs = DefaultGroups
+	}
+	if opt.BlankDotGroups {
+		specs = append(specs[:len(specs):len(specs)], "blank", "dot")
+	}
+	g, err := ParseGrouping(specs, localPrefix)
+	if err != nil {
+		return nil, err
+	}
+	g.localFirst = opt.Groups == nil
+	return g, nil
+}
+
+// localPrefix returns opt.LocalPrefix with LocalAuto replaced by the paths
+// of the main modules.
+func (opt *Options) localPrefix() (string, error) {
+	prefixes := strings.Split(opt.LocalPrefix, ",")
+	auto := false
+	for _, p := range prefixes {
+		auto = auto || p == LocalAuto
+	}
+	if !auto {
+		return opt.LocalPrefix, nil
+	}
+
+	var mains []string
+	resolver, err := opt.Env.GetResolver()
+	if err != nil {
+		return "", err
+	}
+	if r, ok := resolver.(*ModuleResolver); ok {
+		if err := r.init(); err != nil {
+			return "", err
+		}
+		for _, mod := range r.mains {
+			// The trailing slash keeps example.com/mod from matching
+			// example.com/module.
+			mains = append(mains, mod.Path+"/")
+		}
+	}
+	var res []string
+	for _, p := range prefixes {
+		if p == LocalAuto {
+			res = append(res, mains...)
+		} else {
+			res = append(res, p)
+		}
+	}
+	return strings.Join(res, ","), nil
+}
+
+// Len returns the number of groups.
+func (g *Grouping) Len() int {
+	return len(g.groups)
+}
+
+// Group returns the index of the group of the import of importPath named
+// name, which is empty for imports without a name.
+func (g *Grouping) Group(name, importPath string) int {
+	best, bestRank, bestLen := 0, -1, 0
+	for i, group := range g.groups {
+		for _, m := range group {
+			rank, n, ok := m.match(name, importPath)
+			if g.localFirst && m.kind == "local" {
+				rank = rankLocal
+			}
+			if ok && (rank > bestRank || rank == bestRank && n > bestLen) {
+				best, bestRank, bestLen = i, rank, n
+			}
+		}
+	}
+	return best
+}
+
+// match reports whether m matches the import of importPath named name, with
+// the rank of m and, for prefixes, the length of the prefix.
+func (m groupMatcher) match(name, importPath string) (rank, n int, ok bool) {
+	switch m.kind {
+	case "blank":
+		return rankName, 0, name == "_"
+	case "dot":
+		return rankName, 0, name == "."
+	case "default":
+		return rankDefault, 0, true
+	case "std":
+		firstComponent := strings.Split(importPath, "/")[0]
+		return rankStd, 0, !strings.Contains(firstComponent, ".")
+	case "local", "prefix":
+		ok := strings.HasPrefix(importPath, m.prefix) || strings.TrimSuffix(m.prefix, "/") == importPath
+		return rankPrefix, len(m.prefix), ok
+	case "glob":
+		for p := importPath; ; {
+			if ok, _ := path.Match(m.glob, p); ok {
+				return rankPattern, 0, true
+			}
+			i := strings.LastIndex(p, "/")
+			if i < 0 {
+				return rankPattern, 0, false
+			}
+			p = p[:i]
+		}
+	case "regexp":
+		return rankPattern, 0, m.re.MatchString(importPath)
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,268 @@
+package imports
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rinchsan/gosimports/internal/testenv"
+)
+
+func TestGrouping(t *testing.T) {
+	specs := []string{
+		"std",
+		"prefix:golang.org/x/",
+		"default",
+		"prefix:github.com/ourorg/ glob:*.ourorg.com",
+		"regexp:/internal(/|$)",
+		"local",
+	}
+	g, err := ParseGrouping(specs, "github.com/ourorg/repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want int
+	}{
+		{"fmt", 0},
+		{"net/http", 0},
+		{"golang.org/x/tools/imports", 1},
+		{"golang.org/x", 1},
+		{"golang.org/xerrors", 2},
+		{"github.com/pkg/errors", 2},
+		{"github.com/ourorg/lib", 3},
+		{"go.ourorg.com/lib/sub", 3},
+		{"example.com/internal/lib", 4},
+		{"example.com/internals", 2},
+		{"github.com/ourorg/repo/pkg", 5},     // longer prefix than group 3
+		{"github.com/ourorg/lib/internal", 3}, // prefixes win over regexps
+	}
+	for _, tt := range tests {
+		if got := g.Group("", tt.path); got != tt.want {
+			t.Errorf("Group(%q) = %d, want %d", tt.path, got, tt.want)
+		}
+	}
+}
+
+// oldImportToGroup is how imports were grouped before groups were
+// configurable.
+func oldImportToGroup(localPrefix, importPath string) int {
+	if localPrefix != "" {
+		for _, p := range strings.Split(localPrefix, ",") {
+			if strings.HasPrefix(importPath, p) || strings.TrimSuffix(p, "/") == importPath {
+				return 3
+			}
+		}
+	}
+	if strings.HasPrefix(importPath, "appengine") {
+		return 2
+	}
+	if firstComponent := strings.Split(importPath, "/")[0]; strings.Contains(firstComponent, ".") {
+		return 1
+	}
+	return 0
+}
+
+func TestDefaultGrouping(t *testing.T) {
+	paths := []string{
+		"fmt", "net/http", "appengine", "appengine/foo", "appengine_internal/x",
+		"google.golang.org/appengine", "app", "app/x", "example.com/lib",
+		"example.com/lib/sub", "example.com/library", "github.com/ourorg/repo",
+	}
+	for _, localPrefix := range []string{
+		"", "appengine", "app", "appengine/foo", "example.com/lib",
+		"example.com/lib/", "app,example.com", "github.com/ourorg/repo,appengine",
+	} {
+		g := defaultGrouping(localPrefix)
+		for _, path := range paths {
+			if got, want := g.Group("", path), oldImportToGroup(localPrefix, path); got != want {
+				t.Errorf("defaultGrouping(%q).Group(%q) = %d, want %d", localPrefix, path, got, want)
+			}
+		}
+	}
+
+	// Blank and dot groups don't change the precedence of local prefixes.
+	opt := &Options{LocalPrefix: "app", BlankDotGroups: true}
+	g, err := opt.grouping()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := g.Group("", "appengine/foo"); got != 3 {
+		t.Errorf("Group(appengine/foo) = %d with blank and dot groups, want 3", got)
+	}
+	if got := g.Group("_", "appengine/foo"); got != 4 {
+		t.Errorf("Group(_ appengine/foo) = %d with blank and dot groups, want 4", got)
+	}
+}
+
+func TestProcessBlankDotGroups(t *testing.T) {
+	const src = `package p
+
+import (
+	_ "github.com/lib/pq"
+	"fmt"
+	. "github.com/onsi/gomega"
+	_ "embed"
+	"github.com/pkg/errors"
+	. "github.com/onsi/ginkgo"
+)
+`
+	const want = `package p
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	_ "embed"
+	_ "github.com/lib/pq"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+`
+	opts := &Options{
+		BlankDotGroups: true,
+		Comments:       true,
+		TabIndent:      true,
+		TabWidth:       8,
+		FormatOnly:     true,
+	}
+	got, err := Process("p.go", []byte(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestParseGroupingErrors(t *testing.T) {
+	for _, specs := range [][]string{
+		{"std"},
+		{"default", "default"},
+		{"default", ""},
+		{"default", "prefix:"},
+		{"default", "std:x"},
+		{"default", "glob:["},
+		{"default", "regexp:("},
+		{"default", "module"},
+	} {
+		if _, err := ParseGrouping(specs, ""); err == nil {
+			t.Errorf("ParseGrouping(%q) succeeded, want error", specs)
+		}
+	}
+}
+
+func TestProcessGroups(t *testing.T) {
+	const src = `package p
+
+import (
+	"github.com/ourorg/repo/util"
+	"fmt"
+	"golang.org/x/sync/errgroup"
+	"github.com/pkg/errors"
+	"github.com/ourorg/lib"
+)
+`
+	const want = `package p
+
+import (
+	"fmt"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/pkg/errors"
+
+	"github.com/ourorg/lib"
+
+	"github.com/ourorg/repo/util"
+)
+`
+	opts := &Options{
+		LocalPrefix: "github.com/ourorg/repo",
+		Groups:      []string{"std", "prefix:golang.org/x/", "default", "prefix:github.com/ourorg/", "local"},
+		Comments:    true,
+		TabIndent:   true,
+		TabWidth:    8,
+		FormatOnly:  true,
+	}
+	got, err := Process("p.go", []byte(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	opts.Groups = []string{"std"}
+	if _, err := Process("p.go", []byte(src), opts); err == nil {
+		t.Error("Process succeeded with invalid groups")
+	}
+}
+
+func TestLocalAuto(t *testing.T) {
+	testenv.NeedsGo1Point(t, 18)
+
+	mt := setup(t, nil, `
+-- go.work --
+go 1.18
+
+use (
+	./a
+	./b
+)
+-- a/go.mod --
+module example.com/a
+
+go 1.18
+-- a/a.go --
+package a
+-- b/go.mod --
+module example.com/b
+
+go 1.18
+-- b/b.go --
+package b
+`, "a")
+	defer mt.cleanup()
+
+	const src = `package a
+
+import (
+	"example.com/b"
+	"example.com/bb"
+	"fmt"
+	"example.com/c"
+	"example.com/a/sub"
+)
+`
+	const want = `package a
+
+import (
+	"fmt"
+
+	"example.com/bb"
+
+	"example.com/a/sub"
+	"example.com/b"
+	"example.com/c"
+)
+`
+	opts := &Options{
+		Env:         mt.env,
+		LocalPrefix: "auto,example.com/c",
+		Comments:    true,
+		TabIndent:   true,
+		TabWidth:    8,
+		FormatOnly:  true,
+	}
+	got, err := Process(filepath.Join(mt.env.WorkingDir, "a.go"), []byte(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -9,19 +9,19 @@
 package imports
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/format"
 	"go/parser"
 	"go/printer"
+	"go/scanner"
 	"go/token"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
-
-	"golang.org/x/tools/go/ast/astutil"
 )
 
 // Options is golang.org/x/tools/imports.Options with extra internal-only options.
@@ -30,9 +30,29 @@ type Options struct {
 
 	// LocalPrefix is a comma-separated string of import path prefixes, which, if
 	// set, instructs Process to sort the import paths with the given prefixes
-	// into another group after 3rd-party packages.
+	// into another group after 3rd-party packages, or the group of Groups
+	// with the local matcher.
 	LocalPrefix string
 
+	// Groups lists the groups imports are separated into, in order, as
+	// parsed by ParseGrouping. If nil, DefaultGroups are used.
+	Groups []string
+
+	// BlankDotGroups places blank imports and dot imports in groups of
+	// their own after those of Groups.
+	BlankDotGroups bool
+
+	// Aliases maps import paths to the names their imports must have.
+	// Process names the imports accordingly, along with the references
+	// to them, and reports an AliasConflict fix instead when the file
+	// uses the name for something else.
+	Aliases map[string]string
+
+	// RemoveRedundantAliases removes the names of imports that are the
+	// names of their packages already, like errors "errors", unless
+	// Aliases requires them.
+	RemoveRedundantAliases bool
+
 	Fragment  bool // Accept fragment of a source file (no package statement)
 	AllErrors bool // Report all errors (not just the first 10 on different lines)
 
@@ -41,24 +61,100 @@ type Options struct {
 	TabWidth  int  // Tab width (8 if nil *Options provided)
 
 	FormatOnly bool // Disable the insertion and deletion of imports
+
+	Generated GeneratedPolicy // How to process generated files
+
+	// Overlay holds the contents of files, keyed by absolute path, to use
+	// instead of those on disk when looking at the other files of the
+	// package. The files need not exist on disk.
+	Overlay map[string][]byte
 }
 
+// GeneratedPolicy controls how Process handles generated files: files with
+// a comment matching the regular expression
+//
+//	^// Code generated .* DO NOT EDIT\.$
+//
+// before the package clause, as described at https://go.dev/s/generatedcode.
+type GeneratedPolicy int
+
+const (
+	// GeneratedFull processes generated files like any other file.
+	GeneratedFull GeneratedPolicy = iota
+
+	// GeneratedFormatOnly formats generated files without inserting or
+	// deleting imports, as if FormatOnly were set.
+	GeneratedFormatOnly
+
+	// GeneratedSkip leaves generated files unchanged.
+	GeneratedSkip
+)
+
 // Process implements golang.org/x/tools/imports.Process with explicit context in opt.Env.
 func Process(filename string, src []byte, opt *Options) (formatted []byte, err error) {
+	formatted, _, err = ProcessFixes(filename, src, opt)
+	return formatted, err
+}
+
+// ProcessFixes is like Process, but also returns the fixes that were applied
+// to the imports of the file. There are none if opt.FormatOnly is set.
+func ProcessFixes(filename string, src []byte, opt *Options) (formatted []byte, fixes []*ImportFix, err error) {
 	fileSet := token.NewFileSet()
 	file, adjust, err := parse(fileSet, filename, src, opt)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if !opt.FormatOnly {
-		if err := fixImports(fileSet, file, filename, opt.Env); err != nil {
-			return nil, err
+	formatOnly := opt.FormatOnly
+	if opt.Generated != GeneratedFull && isGenerated(src) {
+		if opt.Generated == GeneratedSkip {
+			return src, nil, nil
+		}
+		formatOnly = true
+	}
+
+	if !formatOnly {
+		if fixes, err = fixImports(fileSet, file, filename, opt.Env, opt.Overlay, opt.aliasPolicy()); err != nil {
+			return nil, nil, err
 		}
 	}
+	formatted, err = formatFile(fileSet, file, src, adjust, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return formatted, fixes, nil
+}
+
+// ApplyFixes applies fixes to the imports of the file in src, formatting
+// it as Process does, without looking for any other fixes.
+func ApplyFixes(fixes []*ImportFix, filename string, src []byte, opt *Options) (formatted []byte, err error) {
+	fileSet := token.NewFileSet()
+	file, adjust, err := parse(fileSet, filename, src, opt)
+	if err != nil {
+		return nil, err
+	}
+	apply(fileSet, file, fixes)
 	return formatFile(fileSet, file, src, adjust, opt)
 }
 
+// isGenerated reports whether src has a comment marking it as generated
+// before its first token, as described for GeneratedPolicy.
+func isGenerated(src []byte) bool {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	s.Init(fset.AddFile("", fset.Base(), len(src)), src, nil, scanner.ScanComments)
+	for {
+		_, tok, lit := s.Scan()
+		if tok != token.COMMENT {
+			return false
+		}
+		const prefix, suffix = "// Code generated ", " DO NOT EDIT."
+		if len(lit) >= len(prefix)+len(suffix) && strings.HasPrefix(lit, prefix) && strings.HasSuffix(lit, suffix) {
+			return true
+		}
+	}
+}
+
 // formatFile formats the file syntax tree.
 // It may mutate the token.FileSet.
 //
@@ -66,16 +162,44 @@ func Process(filename string, src []byte, opt *Options) (formatted []byte, err e
 // with the original source (formatFile's src parameter) and the
 // formatted file, and returns the postpocessed result.
 func formatFile(fset *token.FileSet, file *ast.File, src []byte, adjust func(orig []byte, src []byte) []byte, opt *Options) ([]byte, error) {
+	groups, err := opt.grouping()
+	if err != nil {
+		return nil, err
+	}
+	cgo := splitCgoImports(file)
+	comments := takeImportComments(file)
 	mergeImports(file)
-	sortImports(opt.LocalPrefix, fset.File(file.Pos()), file)
+	sortImports(groups, fset.File(file.Pos()), file)
+
+	// Regroup the imports of the declaration the others were merged into,
+	// if it is parenthesized.
+	index, decl := mergedImportDecl(file)
+	if decl != nil && !decl.Lparen.IsValid() {
+		decl = nil
+	}
 	impsByGroup := make(map[int][]*ast.ImportSpec)
-	for _, impSection := range astutil.Imports(fset, file) {
-		for _, importSpec := range impSection {
+	kept := map[*ast.ImportSpec]bool{}
+	if decl != nil {
+		for _, spec := range decl.Specs {
+			importSpec := spec.(*ast.ImportSpec)
 			importPath, _ := strconv.Unquote(importSpec.Path.Value)
-			groupNum := importGroup(opt.LocalPrefix, importPath)
+			groupNum := groups.Group(importName(importSpec), importPath)
 			impsByGroup[groupNum] = append(impsByGroup[groupNum], importSpec)
+			kept[importSpec] = true
+		}
+	}
+	// The sections of the import block were sorted separately; sort each
+	// group as a whole so that comments stay with their imports.
+	for _, imps := range impsByGroup {
+		sort.SliceStable(imps, func(i, j int) bool { return importLess(imps[i], imps[j]) })
+	}
+	for spec, cgs := range comments.leading {
+		if !kept[spec] {
+			// The import was a duplicate removed by sortImports.
+			comments.top = append(comments.top, cgs...)
 		}
 	}
+	sort.Sort(byCommentPos(comments.top))
 
 	printerMode := printer.UseSpaces
 	if opt.TabIndent {
@@ -88,13 +212,15 @@ func formatFile(fset *token.FileSet, file *ast.File, src []byte, adjust func(ori
 		return nil, err
 	}
 	out := buf.Bytes()
+	if decl != nil {
+		out, err = renderImportBlock(out, index, groups.Len(), impsByGroup, comments, cgo)
+		if err != nil {
+			return nil, err
+		}
+	}
 	if adjust != nil {
 		out = adjust(src, out)
 	}
-	out, err := separateImportsIntoGroups(bytes.NewReader(out), impsByGroup)
-	if err != nil {
-		return nil, err
-	}
 
 	out, err = format.Source(out)
 	if err != nil {
@@ -255,56 +381,149 @@ func matchSpace(orig []byte, src []byte) []byte {
 	return b.Bytes()
 }
 
-// separateImportsIntoGroups separates import lines into groups determined by importGroup func.
-func separateImportsIntoGroups(r io.Reader, impsByGroup map[int][]*ast.ImportSpec) ([]byte, error) {
-	var out bytes.Buffer
-	in := bufio.NewReader(r)
-	inImports := false
-	done := false
-	impInserted := false
-	for {
-		s, err := in.ReadString('\n')
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			return nil, err
-		}
+// importComments are the comments of an import block, other than those
+// trailing an import, which renderImportBlock prints along with the
+// imports.
+type importComments struct {
+	top     []*ast.CommentGroup // printed at the top of the block
+	bottom  []*ast.CommentGroup // printed after the last import
+	leading map[*ast.ImportSpec][]*ast.CommentGroup
+}
 
-		if !inImports && !done && strings.HasPrefix(s, "import") && strings.Contains(s, "(") {
-			inImports = true
-			fmt.Fprint(&out, s)
+// takeImportComments removes from file the comments of the import
+// declarations that mergeImports merges, and returns them: the comments
+// preceding an import, including the doc comments of the declarations
+// merged into the first, lead it, and those after the last import of a
+// declaration stay after the last import of the block.
+func takeImportComments(file *ast.File) importComments {
+	comments := importComments{leading: map[*ast.ImportSpec][]*ast.CommentGroup{}}
+	taken := map[*ast.CommentGroup]bool{}
+	first := true
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT || declImports(gen, "C") || len(gen.Specs) == 0 {
 			continue
 		}
-		if inImports && !impInserted {
-			for i := 0; i <= 3; i++ {
-				for _, imp := range impsByGroup[i] {
-					if imp.Path.Value == `"C"` {
-						continue
-					}
-					if imp.Name != nil {
-						fmt.Fprint(&out, imp.Name.Name, " ")
-					}
-					fmt.Fprint(&out, imp.Path.Value)
-					if imp.Comment != nil {
-						for _, comment := range imp.Comment.List {
-							fmt.Fprint(&out, " ", comment.Text)
-						}
-					}
-					out.WriteByte('\n')
-				}
-				out.WriteByte('\n')
-			}
-			impInserted = true
+		spec := gen.Specs[0].(*ast.ImportSpec)
+		if !first && gen.Doc != nil {
+			comments.leading[spec] = append(comments.leading[spec], gen.Doc)
+			taken[gen.Doc] = true
+		}
+		first = false
+		if !gen.Lparen.IsValid() {
 			continue
 		}
-		if inImports && !strings.Contains(s, "//") && strings.Contains(s, ")") {
-			done = true
-			inImports = false
+		trailing := map[*ast.CommentGroup]bool{}
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if spec.Comment != nil {
+				trailing[spec.Comment] = true
+			}
+			// Keep the printer from printing the doc comment too.
+			spec.Doc = nil
+		}
+		for _, cg := range file.Comments {
+			if cg.Pos() < gen.Lparen || cg.End() > gen.Rparen || trailing[cg] {
+				continue
+			}
+			i := sort.Search(len(gen.Specs), func(i int) bool { return gen.Specs[i].End() > cg.Pos() })
+			switch {
+			case i == len(gen.Specs):
+				comments.bottom = append(comments.bottom, cg)
+			case gen.Specs[i].Pos() < cg.Pos():
+				continue // within the import, or trailing it
+			default:
+				spec := gen.Specs[i].(*ast.ImportSpec)
+				comments.leading[spec] = append(comments.leading[spec], cg)
+			}
+			taken[cg] = true
+		}
+	}
+	if len(taken) > 0 {
+		var rest []*ast.CommentGroup
+		for _, cg := range file.Comments {
+			if !taken[cg] {
+				rest = append(rest, cg)
+			}
+		}
+		file.Comments = rest
+	}
+	return comments
+}
+
+// renderImportBlock replaces the contents of the index-th import
+// declaration of src, a printed file, which must be parenthesized, with the
+// imports of impsByGroup separated into n groups, along with comments. The
+// imports of "C" in cgo, with their preambles, follow in declarations of
+// their own.
+func renderImportBlock(src []byte, index, n int, impsByGroup map[int][]*ast.ImportSpec, comments importComments, cgo []*ast.ImportSpec) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	var decl *ast.GenDecl
+	for _, d := range file.Decls {
+		if gen, ok := d.(*ast.GenDecl); ok && gen.Tok == token.IMPORT {
+			if index == 0 {
+				decl = gen
+				break
+			}
+			index--
 		}
+	}
+	if decl == nil || !decl.Lparen.IsValid() {
+		return nil, errors.New("parenthesized import declaration not found in printed file")
+	}
+	tokFile := fset.File(file.Pos())
+	start, end := tokFile.Offset(decl.Lparen)+1, tokFile.Offset(decl.Rparen)
 
-		if !inImports {
-			fmt.Fprint(&out, s)
+	var out bytes.Buffer
+	out.Write(src[:start])
+	out.WriteByte('\n')
+	writeComments(&out, comments.top)
+	for i := 0; i < n; i++ {
+		for _, imp := range impsByGroup[i] {
+			writeComments(&out, comments.leading[imp])
+			if imp.Name != nil {
+				fmt.Fprint(&out, imp.Name.Name, " ")
+			}
+			fmt.Fprint(&out, imp.Path.Value)
+			if imp.Comment != nil {
+				for _, comment := range imp.Comment.List {
+					fmt.Fprint(&out, " ", comment.Text)
+				}
+			}
+			out.WriteByte('\n')
 		}
+		out.WriteByte('\n')
+	}
+	if len(comments.bottom) > 0 {
+		out.Truncate(len(bytes.TrimRight(out.Bytes(), "\n")) + 1)
+		writeComments(&out, comments.bottom)
 	}
+	out.WriteByte(')')
+	for _, imp := range cgo {
+		out.WriteString("\n\n")
+		if imp.Doc != nil {
+			writeComments(&out, []*ast.CommentGroup{imp.Doc})
+		}
+		fmt.Fprint(&out, "import ", imp.Path.Value)
+		if imp.Comment != nil {
+			for _, comment := range imp.Comment.List {
+				fmt.Fprint(&out, " ", comment.Text)
+			}
+		}
+	}
+	out.Write(src[end+1:])
 	return out.Bytes(), nil
 }
+
+// writeComments writes each comment of cgs on lines of its own.
+func writeComments(w io.Writer, cgs []*ast.CommentGroup) {
+	for _, cg := range cgs {
+		for _, c := range cg.List {
+			fmt.Fprintln(w, c.Text)
+		}
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/rinchsan/gosimports/internal/gocommand"
 	"github.com/rinchsan/gosimports/internal/gopathwalk"
@@ -32,6 +33,7 @@ type ModuleResolver struct {
 	scanSema       chan struct{} // scanSema prevents concurrent scans and guards scannedRoots.
 	scannedRoots   map[gopathwalk.Root]bool
 
+	initMu        sync.Mutex // initMu guards initialization, which may be requested concurrently.
 	initialized   bool
 	mains         []*gocommand.ModuleJSON
 	mainByDir     map[string]*gocommand.ModuleJSON
@@ -53,6 +55,8 @@ func newModuleResolver(e *ProcessEnv) *ModuleResolver {
 }
 
 func (r *ModuleResolver) init() error {
+	r.initMu.Lock()
+	defer r.initMu.Unlock()
 	if r.initialized {
 		return nil
 	}
@@ -215,6 +219,8 @@ func (r *ModuleResolver) ClearForNewScan() {
 	r.scanSema <- struct{}{}
 }
 
+// ClearForNewMod discards everything the resolver knows about the main
+// module(s). It must not be called concurrently with other uses of r.
 func (r *ModuleResolver) ClearForNewMod() {
 	<-r.scanSema
 	*r = ModuleResolver{
@@ -521,11 +527,15 @@ func (r *ModuleResolver) scan(ctx context.Context, callback *scanCallback) error
 	return nil
 }
 
+// OutOfScopeRelevance is the relevance of the packages found in the module
+// cache that belong to no module required by the main modules.
+const OutOfScopeRelevance = MaxRelevance - 4
+
 func modRelevance(mod *gocommand.ModuleJSON) float64 {
 	var relevance float64
 	switch {
 	case mod == nil: // out of scope
-		return MaxRelevance - 4
+		return OutOfScopeRelevance
 	case mod.Indirect:
 		relevance = MaxRelevance - 3
 	case !mod.Main:
@@ -0,0 +1,115 @@
+package imports
+
+import (
+	"go/ast"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// RewriteImports rewrites the import paths of the file in src beginning
+// with a key of rewrites, as a whole or followed by a slash, to begin with
+// its value instead, using the longest key matching. The identifiers the
+// file refers to the packages by are kept: an import is named after the
+// package it imported before when the package imported now has another
+// name. The file is then formatted as Process does, unless it imports no
+// path to rewrite, in which case src is returned as is. So are generated
+// files, unless opt.Generated is GeneratedFull.
+//
+// The fixes returned describe each rewrite as the removal of the import of
+// the old path and the addition of the import of the new one.
+func RewriteImports(filename string, src []byte, rewrites map[string]string, opt *Options) ([]byte, []*ImportFix, error) {
+	fileSet := token.NewFileSet()
+	file, adjust, err := parse(fileSet, filename, src, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opt.Generated != GeneratedFull && isGenerated(src) {
+		return src, nil, nil
+	}
+
+	type rewrite struct {
+		spec *ast.ImportSpec
+		imp  *ImportInfo // before the rewrite
+		path string
+	}
+	var todo []rewrite
+	for _, imp := range file.Imports {
+		path := importPath(imp)
+		if newPath, ok := rewritePath(path, rewrites); ok {
+			info := &ImportInfo{ImportPath: path}
+			if imp.Name != nil {
+				info.Name = imp.Name.Name
+			}
+			todo = append(todo, rewrite{spec: imp, imp: info, path: newPath})
+		}
+	}
+	if len(todo) == 0 {
+		return src, nil, nil
+	}
+
+	p, _, err := namingPass(fileSet, file, filename, opt.Env)
+	if err != nil {
+		return nil, nil, err
+	}
+	var newImps []*ImportInfo
+	for _, r := range todo {
+		newImps = append(newImps, &ImportInfo{ImportPath: r.path})
+	}
+	if err := p.loadPackageNames(newImps); err != nil {
+		return nil, nil, err
+	}
+
+	var fixes []*ImportFix
+	for i, r := range todo {
+		name, ident := r.imp.Name, p.importIdentifier(r.imp)
+		if name != "_" && name != "." && p.importIdentifier(newImps[i]) != ident {
+			// Keep referring to the package by the name it had.
+			name = ident
+		}
+		if name != r.imp.Name {
+			r.spec.Name = &ast.Ident{
+				Name:    name,
+				NamePos: r.spec.Pos(),
+			}
+		}
+		r.spec.Path.Value = strconv.Quote(r.path)
+		fixes = append(fixes,
+			&ImportFix{StmtInfo: *r.imp, IdentName: ident, FixType: DeleteImport},
+			&ImportFix{StmtInfo: ImportInfo{ImportPath: r.path, Name: name}, IdentName: ident, FixType: AddImport},
+		)
+	}
+	formatted, err := formatFile(fileSet, file, src, adjust, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	return formatted, fixes, nil
+}
+
+// rewritePath returns path rewritten by the longest key of rewrites it
+// begins with, as a whole or followed by a slash, and whether there is one.
+// When the new path is below the old one, as a new major version is, a
+// path already beginning with the new path is left alone, so that
+// rewriting is idempotent.
+func rewritePath(path string, rewrites map[string]string) (string, bool) {
+	best := ""
+	for old := range rewrites {
+		if len(old) > len(best) && hasPathPrefix(path, old) {
+			best = old
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	to := rewrites[best]
+	if hasPathPrefix(to, best) && hasPathPrefix(path, to) {
+		return "", false
+	}
+	return to + path[len(best):], true
+}
+
+// hasPathPrefix reports whether path is prefix or begins with it followed
+// by a slash.
+func hasPathPrefix(path, prefix string) bool {
+	return path == prefix || strings.HasPrefix(path, prefix+"/")
+}
@@ -0,0 +1,235 @@
+package imports
+
+import (
+	"reflect"
+	"testing"
+
+	"golang.org/x/tools/go/packages/packagestest"
+)
+
+func TestRewriteImports(t *testing.T) {
+	rewrites := map[string]string{
+		"foo.com/old/bar": "foo.com/new/baz",
+		"foo.com/lib":     "foo.com/lib/v2",
+		"foo.com/lib/gen": "foo.com/gen",
+	}
+	tests := []struct {
+		name string
+		in   string
+		out  string
+	}{
+		{
+			name: "package_renamed",
+			in: `package x
+
+import "foo.com/old/bar"
+
+var _ = bar.X
+`,
+			out: `package x
+
+import bar "foo.com/new/baz"
+
+var _ = bar.X
+`,
+		},
+		{
+			name: "major_version",
+			in: `package x
+
+import (
+	"foo.com/lib"
+	"foo.com/lib/sub"
+	"foo.com/libx"
+)
+
+var _, _, _ = lib.X, sub.X, libx.X
+`,
+			out: `package x
+
+import (
+	"foo.com/lib/v2"
+	"foo.com/lib/v2/sub"
+	"foo.com/libx"
+)
+
+var _, _, _ = lib.X, sub.X, libx.X
+`,
+		},
+		{
+			name: "longest_prefix_and_sorting",
+			in: `package x
+
+import (
+	"fmt"
+
+	"foo.com/a"
+	"foo.com/lib/gen/z"
+)
+
+var _, _, _ = fmt.Print, a.X, z.X
+`,
+			out: `package x
+
+import (
+	"fmt"
+
+	"foo.com/a"
+	"foo.com/gen/z"
+)
+
+var _, _, _ = fmt.Print, a.X, z.X
+`,
+		},
+		{
+			name: "named_and_blank_imports",
+			in: `package x
+
+import (
+	b "foo.com/old/bar"
+	_ "foo.com/old/bar/side"
+)
+
+var _ = b.X
+`,
+			out: `package x
+
+import (
+	b "foo.com/new/baz"
+	_ "foo.com/new/baz/side"
+)
+
+var _ = b.X
+`,
+		},
+		{
+			name: "nothing_to_rewrite",
+			in: `package x
+import ("fmt"; "foo.com/a")
+var _, _ = fmt.Print, a.X
+`,
+			out: `package x
+import ("fmt"; "foo.com/a")
+var _, _ = fmt.Print, a.X
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testConfig{
+				module: packagestest.Module{
+					Name: "foo.com",
+					Files: fm{
+						"old/bar/x.go":      "package bar\nvar X int\n",
+						"new/baz/x.go":      "package baz\nvar X int\n",
+						"lib/x.go":          "package lib\nvar X int\n",
+						"lib/v2/x.go":       "package lib\nvar X int\n",
+						"lib/v2/sub/x.go":   "package sub\nvar X int\n",
+						"libx/x.go":         "package libx\nvar X int\n",
+						"gen/z/x.go":        "package z\nvar X int\n",
+						"a/x.go":            "package a\nvar X int\n",
+						"new/baz/side/x.go": "package side\n",
+						"x/x.go":            tt.in,
+					},
+				},
+			}.test(t, func(t *goimportTest) {
+				opts := &Options{Env: t.env.CopyConfig(), Comments: true, TabIndent: true, TabWidth: 8}
+				got, _, err := RewriteImports(t.exported.File("foo.com", "x/x.go"), []byte(tt.in), rewrites, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != tt.out {
+					t.Errorf("got:\n%s\nwant:\n%s", got, tt.out)
+				}
+				// Rewriting is idempotent, even when the new path is below
+				// the old one.
+				again, _, err := RewriteImports(t.exported.File("foo.com", "x/x.go"), got, rewrites, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(again) != string(got) {
+					t.Errorf("rewriting again got:\n%s\nwant:\n%s", again, got)
+				}
+			})
+		})
+	}
+}
+
+func TestRewriteImportsFixes(t *testing.T) {
+	const src = `package x
+
+import "foo.com/old/bar"
+
+var _ = bar.X
+`
+	testConfig{
+		module: packagestest.Module{
+			Name: "foo.com",
+			Files: fm{
+				"new/bar/x.go": "package baz\nvar X int\n",
+				"x/x.go":       src,
+			},
+		},
+	}.test(t, func(t *goimportTest) {
+		opts := &Options{Env: t.env.CopyConfig(), Comments: true, TabIndent: true, TabWidth: 8}
+		rewrites := map[string]string{"foo.com/old": "foo.com/new"}
+		_, fixes, err := RewriteImports(t.exported.File("foo.com", "x/x.go"), []byte(src), rewrites, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The old package is gone, and so is assumed to be named after its
+		// import path, unlike the new one.
+		want := []ImportFix{
+			{StmtInfo: ImportInfo{ImportPath: "foo.com/old/bar"}, IdentName: "bar", FixType: DeleteImport},
+			{StmtInfo: ImportInfo{ImportPath: "foo.com/new/bar", Name: "bar"}, IdentName: "bar", FixType: AddImport},
+		}
+		var got []ImportFix
+		for _, fix := range fixes {
+			got = append(got, *fix)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("fixes = %+v, want %+v", got, want)
+		}
+	})
+}
+
+func TestRewritePath(t *testing.T) {
+	for _, tt := range []struct {
+		old, new string
+		path     string
+		want     string // empty if left alone
+	}{
+		{"example.com/m", "example.com/m/v2", "example.com/m/pkg", "example.com/m/v2/pkg"},
+		{"example.com/m", "example.com/m/v2", "example.com/m/v2/pkg", ""},
+		{"example.com/m/v2", "example.com/m", "example.com/m/v2/pkg", "example.com/m/pkg"},
+		{"example.com/m/pkg/util", "example.com/m/pkg", "example.com/m/pkg/util", "example.com/m/pkg"},
+		{"example.com/m", "example.org/m", "example.com/mod", ""},
+	} {
+		got, ok := rewritePath(tt.path, map[string]string{tt.old: tt.new})
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("rewritePath(%s, %s=>%s) = %q, %v, want %q", tt.path, tt.old, tt.new, got, ok, tt.want)
+		}
+	}
+}
+
+func TestRewriteImportsGenerated(t *testing.T) {
+	const src = `// Code generated by hand. DO NOT EDIT.
+
+package x
+
+import "foo.com/old"
+
+var _ = old.X
+`
+	rewrites := map[string]string{"foo.com/old": "foo.com/new"}
+	for _, policy := range []GeneratedPolicy{GeneratedFormatOnly, GeneratedSkip} {
+		opts := &Options{Comments: true, TabIndent: true, TabWidth: 8, Generated: policy}
+		got, fixes, err := RewriteImports("x.go", []byte(src), rewrites, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != src || len(fixes) != 0 {
+			t.Errorf("policy %d: got %d fixes and:\n%s\nwant the file unchanged", policy, len(fixes), got)
+		}
+	}
+}
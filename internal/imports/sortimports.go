@@ -19,7 +19,7 @@ import (
 // It also removes duplicate imports when it is possible to do so without data loss.
 //
 // It may mutate the token.File.
-func sortImports(localPrefix string, tokFile *token.File, f *ast.File) {
+func sortImports(groups *Grouping, tokFile *token.File, f *ast.File) {
 	for i, d := range f.Decls {
 		d, ok := d.(*ast.GenDecl)
 		if !ok || d.Tok != token.IMPORT {
@@ -44,11 +44,11 @@ func sortImports(localPrefix string, tokFile *token.File, f *ast.File) {
 		for j, s := range d.Specs {
 			if j > i && tokFile.Line(s.Pos()) > 1+tokFile.Line(d.Specs[j-1].End()) {
 				// j begins a new run.  End this one.
-				specs = append(specs, sortSpecs(localPrefix, tokFile, f, d.Specs[i:j])...)
+				specs = append(specs, sortSpecs(groups, tokFile, f, d.Specs[i:j])...)
 				i = j
 			}
 		}
-		specs = append(specs, sortSpecs(localPrefix, tokFile, f, d.Specs[i:])...)
+		specs = append(specs, sortSpecs(groups, tokFile, f, d.Specs[i:])...)
 		d.Specs = specs
 
 		// Deduping can leave a blank line before the rparen; clean that up.
@@ -96,6 +96,65 @@ func mergeImports(f *ast.File) {
 	}
 }
 
+// splitCgoImports removes the imports of "C" from the import declarations
+// importing other packages too, along with their doc comments, which hold
+// their cgo preambles, and trailing comments, and returns them, so that
+// the other imports are merged and grouped as usual while each "C" is
+// printed in a declaration of its own.
+func splitCgoImports(f *ast.File) []*ast.ImportSpec {
+	var cgo []*ast.ImportSpec
+	taken := map[*ast.CommentGroup]bool{}
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT || len(gen.Specs) <= 1 || !declImports(gen, "C") {
+			continue
+		}
+		specs := gen.Specs[:0]
+		for _, spec := range gen.Specs {
+			spec := spec.(*ast.ImportSpec)
+			if importPath(spec) != "C" {
+				specs = append(specs, spec)
+				continue
+			}
+			cgo = append(cgo, spec)
+			if spec.Doc != nil {
+				taken[spec.Doc] = true
+			}
+			if spec.Comment != nil {
+				taken[spec.Comment] = true
+			}
+		}
+		gen.Specs = specs
+	}
+	if len(taken) > 0 {
+		comments := f.Comments[:0]
+		for _, cg := range f.Comments {
+			if !taken[cg] {
+				comments = append(comments, cg)
+			}
+		}
+		f.Comments = comments
+	}
+	return cgo
+}
+
+// mergedImportDecl returns the import declaration mergeImports merges the
+// others into, if any, and its index among the import declarations of f.
+func mergedImportDecl(f *ast.File) (int, *ast.GenDecl) {
+	index := 0
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		if !declImports(gen, "C") {
+			return index, gen
+		}
+		index++
+	}
+	return 0, nil
+}
+
 // declImports reports whether gen contains an import of path.
 // Taken from golang.org/x/tools/ast/astutil.
 func declImports(gen *ast.GenDecl, path string) bool {
@@ -150,7 +209,7 @@ type posSpan struct {
 
 // sortSpecs sorts the import specs within each import decl.
 // It may mutate the token.File.
-func sortSpecs(localPrefix string, tokFile *token.File, f *ast.File, specs []ast.Spec) []ast.Spec {
+func sortSpecs(groups *Grouping, tokFile *token.File, f *ast.File, specs []ast.Spec) []ast.Spec {
 	// Can't short-circuit here even if specs are already sorted,
 	// since they might yet need deduplication.
 	// A lone import, however, may be safely ignored.
@@ -199,7 +258,7 @@ func sortSpecs(localPrefix string, tokFile *token.File, f *ast.File, specs []ast
 	// Reassign the import paths to have the same position sequence.
 	// Reassign each comment to abut the end of its spec.
 	// Sort the comments by new position.
-	sort.Sort(byImportSpec{localPrefix, specs})
+	sort.Sort(byImportSpec{groups, specs})
 
 	// Dedup. Thanks to our sorting, we can just consider
 	// adjacent pairs of imports.
@@ -262,8 +321,8 @@ func sortSpecs(localPrefix string, tokFile *token.File, f *ast.File, specs []ast
 }
 
 type byImportSpec struct {
-	localPrefix string
-	specs       []ast.Spec // slice of *ast.ImportSpec
+	groups *Grouping
+	specs  []ast.Spec // slice of *ast.ImportSpec
 }
 
 func (x byImportSpec) Len() int      { return len(x.specs) }
@@ -272,22 +331,28 @@ func (x byImportSpec) Less(i, j int) bool {
 	ipath := importPath(x.specs[i])
 	jpath := importPath(x.specs[j])
 
-	igroup := importGroup(x.localPrefix, ipath)
-	jgroup := importGroup(x.localPrefix, jpath)
+	igroup := x.groups.Group(importName(x.specs[i]), ipath)
+	jgroup := x.groups.Group(importName(x.specs[j]), jpath)
 	if igroup != jgroup {
 		return igroup < jgroup
 	}
+	return importLess(x.specs[i], x.specs[j])
+}
 
-	if ipath != jpath {
-		return ipath < jpath
+// importLess reports whether the import s sorts before t within a group.
+func importLess(s, t ast.Spec) bool {
+	spath := importPath(s)
+	tpath := importPath(t)
+	if spath != tpath {
+		return spath < tpath
 	}
-	iname := importName(x.specs[i])
-	jname := importName(x.specs[j])
+	sname := importName(s)
+	tname := importName(t)
 
-	if iname != jname {
-		return iname < jname
+	if sname != tname {
+		return sname < tname
 	}
-	return importComment(x.specs[i]) < importComment(x.specs[j])
+	return importComment(s) < importComment(t)
 }
 
 type byCommentPos []*ast.CommentGroup
@@ -0,0 +1,501 @@
+// Package lsp implements a language server that formats Go files and fixes
+// their imports like gosimports does, keeping the state of the workspace,
+// such as the packages found in the module graph, warm between requests.
+//
+// It supports full document formatting, the "organize imports" code action,
+// and the completion of the names of packages that aren't imported yet.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"github.com/rinchsan/gosimports/internal/diff"
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// maxCompletions is the maximum number of completion items returned.
+const maxCompletions = 50
+
+// A Server is a language server communicating over a single connection.
+// Requests are handled one at a time, in the order they are received.
+type Server struct {
+	// Options returns the options for processing the file filename. The
+	// options it returns must share Env, so that its caches are reused.
+	Options func(filename string) (*imports.Options, error)
+
+	// Env is the environment shared by the options. If its WorkingDir is
+	// empty, it is set to the root of the workspace on initialization.
+	Env *imports.ProcessEnv
+
+	// Version is reported to the client as the version of the server.
+	Version string
+
+	// Logf, if non-nil, logs the errors of notifications, which can't be
+	// reported to the client.
+	Logf func(format string, args ...interface{})
+
+	docs     map[DocumentURI][]byte // contents of the open documents, set by initialize
+	shutdown bool
+}
+
+// errMethodNotFound is returned by handle for unknown methods.
+var errMethodNotFound = &ResponseError{Code: codeMethodNotFound, Message: "method not found"}
+
+// Serve reads requests from r and writes the responses to w until the
+// client tells the server to exit. It returns nil if the server was shut
+// down before exiting, as the protocol requires.
+func (s *Server) Serve(r io.Reader, w io.Writer) error {
+	in := bufio.NewReader(r)
+	for {
+		data, err := readMessage(in)
+		if err != nil {
+			if err == io.EOF && s.shutdown {
+				return nil
+			}
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			resp, _ := response(nil, nil, &ResponseError{Code: codeParseError, Message: err.Error()})
+			if err := writeMessage(w, resp); err != nil {
+				return err
+			}
+			continue
+		}
+		if msg.Method == "exit" {
+			if !s.shutdown {
+				return errors.New("exit before shutdown")
+			}
+			return nil
+		}
+
+		result, err := s.handle(msg.Method, msg.Params)
+		if msg.ID == nil {
+			// Notifications have no response.
+			if err != nil && err != errMethodNotFound && s.Logf != nil {
+				s.Logf("%s: %v", msg.Method, err)
+			}
+			continue
+		}
+		resp, err := response(msg.ID, result, err)
+		if err != nil {
+			return err
+		}
+		if err := writeMessage(w, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// handle handles the request or notification method with params.
+func (s *Server) handle(method string, params json.RawMessage) (interface{}, error) {
+	if s.shutdown {
+		return nil, &ResponseError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+	if s.docs == nil && method != "initialize" {
+		return nil, &ResponseError{Code: codeServerNotInitialized, Message: "server not initialized"}
+	}
+	decode := func(v interface{}) error {
+		if err := json.Unmarshal(params, v); err != nil {
+			return &ResponseError{Code: codeInvalidParams, Message: err.Error()}
+		}
+		return nil
+	}
+
+	switch method {
+	case "initialize":
+		var p InitializeParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.initialize(&p), nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+
+	case "textDocument/didOpen":
+		var p DidOpenTextDocumentParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		s.docs[p.TextDocument.URI] = []byte(p.TextDocument.Text)
+		return nil, nil
+	case "textDocument/didChange":
+		var p DidChangeTextDocumentParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		for _, c := range p.ContentChanges {
+			if c.Range != nil {
+				return nil, fmt.Errorf("%s: incremental changes are not supported", p.TextDocument.URI)
+			}
+			s.docs[p.TextDocument.URI] = []byte(c.Text)
+		}
+		return nil, nil
+	case "textDocument/didClose":
+		var p DidCloseTextDocumentParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, nil
+
+	case "textDocument/formatting":
+		var p DocumentFormattingParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.formatting(&p)
+	case "textDocument/codeAction":
+		var p CodeActionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.codeAction(&p)
+	case "textDocument/completion":
+		var p CompletionParams
+		if err := decode(&p); err != nil {
+			return nil, err
+		}
+		return s.completion(&p)
+	}
+	return nil, errMethodNotFound
+}
+
+func (s *Server) initialize(p *InitializeParams) *InitializeResult {
+	s.docs = map[DocumentURI][]byte{}
+	root := p.RootURI
+	if len(p.WorkspaceFolders) > 0 {
+		root = p.WorkspaceFolders[0].URI
+	}
+	if s.Env != nil && s.Env.WorkingDir == "" && root != "" {
+		if dir, err := uriToPath(root); err == nil {
+			s.Env.WorkingDir = dir
+		}
+	}
+	return &InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:           TextDocumentSyncOptions{OpenClose: true, Change: TextDocumentSyncFull},
+			DocumentFormattingProvider: true,
+			CodeActionProvider:         CodeActionOptions{CodeActionKinds: []CodeActionKind{SourceOrganizeImports}},
+			CompletionProvider:         CompletionOptions{},
+		},
+		ServerInfo: ServerInfo{Name: "gosimports", Version: s.Version},
+	}
+}
+
+// document returns the file name and contents of the document uri, which
+// are read from disk unless the document is open.
+func (s *Server) document(uri DocumentURI) (string, []byte, error) {
+	filename, err := uriToPath(uri)
+	if err != nil {
+		return "", nil, err
+	}
+	if src, ok := s.docs[uri]; ok {
+		return filename, src, nil
+	}
+	src, err := os.ReadFile(filename)
+	return filename, src, err
+}
+
+// options returns the options for processing the file filename, with the
+// contents of the open documents overlaying those on disk, so that the
+// imports are chosen as in the files being edited.
+func (s *Server) options(filename string) (*imports.Options, error) {
+	opt, err := s.Options(filename)
+	if err != nil {
+		return nil, err
+	}
+	overlay := map[string][]byte{}
+	for path, src := range opt.Overlay {
+		overlay[path] = src
+	}
+	for uri, src := range s.docs {
+		if path, err := uriToPath(uri); err == nil {
+			overlay[path] = src
+		}
+	}
+	opt.Overlay = overlay
+	return opt, nil
+}
+
+func (s *Server) formatting(p *DocumentFormattingParams) ([]TextEdit, error) {
+	filename, src, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	opt, err := s.options(filename)
+	if err != nil {
+		return nil, err
+	}
+	res, err := imports.Process(filename, src, opt)
+	if err != nil {
+		return nil, err
+	}
+	return textEdits(src, res), nil
+}
+
+func (s *Server) codeAction(p *CodeActionParams) ([]CodeAction, error) {
+	actions := []CodeAction{}
+	if !wantsKind(p.Context.Only, SourceOrganizeImports) {
+		return actions, nil
+	}
+	filename, src, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+	opt, err := s.options(filename)
+	if err != nil {
+		return nil, err
+	}
+	res, fixes, err := imports.ProcessFixes(filename, src, opt)
+	if err != nil {
+		return nil, err
+	}
+	if edits := importEdits(src, res, fixes); len(edits) > 0 {
+		actions = append(actions, CodeAction{
+			Title: "Organize Imports",
+			Kind:  SourceOrganizeImports,
+			Edit:  WorkspaceEdit{Changes: map[DocumentURI][]TextEdit{p.TextDocument.URI: edits}},
+		})
+	}
+	return actions, nil
+}
+
+// wantsKind reports whether a client asking only for actions of the kinds
+// only, if any, wants actions of the kind kind.
+func wantsKind(only []CodeActionKind, kind CodeActionKind) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, k := range only {
+		if k == kind || strings.HasPrefix(string(kind), string(k)+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) completion(p *CompletionParams) (*CompletionList, error) {
+	list := &CompletionList{Items: []CompletionItem{}}
+	filename, src, err := s.document(p.TextDocument.URI)
+	if err != nil {
+		return nil, err
+	}
+
+	// Complete the identifier before the cursor, unless it is a selector.
+	end := offset(src, p.Position)
+	start := end
+	for start > 0 {
+		r, size := utf8.DecodeLastRune(src[:start])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		start -= size
+	}
+	prefix := string(src[start:end])
+	if prefix == "" || unicode.IsDigit([]rune(prefix)[0]) || (start > 0 && src[start-1] == '.') {
+		return list, nil
+	}
+
+	// The file is likely incomplete while typing: make do with what can
+	// be parsed of it.
+	f, _ := parser.ParseFile(token.NewFileSet(), filename, src, parser.ImportsOnly)
+	if f == nil || f.Name == nil {
+		return list, nil
+	}
+	imported := map[string]bool{}
+	for _, imp := range f.Imports {
+		if path, err := strconv.Unquote(imp.Path.Value); err == nil {
+			imported[path] = true
+		}
+	}
+
+	opt, err := s.options(filename)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		mu    sync.Mutex
+		fixes = map[string]imports.ImportFix{}
+	)
+	err = imports.GetAllCandidates(context.Background(), func(fix imports.ImportFix) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !imported[fix.StmtInfo.ImportPath] {
+			fixes[fix.StmtInfo.ImportPath] = fix
+		}
+	}, prefix, filename, f.Name.Name, opt.Env)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]imports.ImportFix, 0, len(fixes))
+	for _, fix := range fixes {
+		sorted = append(sorted, fix)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		fi, fj := sorted[i], sorted[j]
+		if fi.Relevance != fj.Relevance {
+			return fi.Relevance > fj.Relevance
+		}
+		if fi.IdentName != fj.IdentName {
+			return fi.IdentName < fj.IdentName
+		}
+		return fi.StmtInfo.ImportPath < fj.StmtInfo.ImportPath
+	})
+	if len(sorted) > maxCompletions {
+		sorted = sorted[:maxCompletions]
+		list.IsIncomplete = true
+	}
+
+	for i, fix := range sorted {
+		item := CompletionItem{
+			Label:    fix.IdentName,
+			Kind:     CompletionItemModule,
+			Detail:   strconv.Quote(fix.StmtInfo.ImportPath),
+			SortText: fmt.Sprintf("%05d", i),
+		}
+		fix := fix
+		if res, err := imports.ApplyFixes([]*imports.ImportFix{&fix}, filename, src, opt); err == nil {
+			item.AdditionalTextEdits = importEdits(src, res, []*imports.ImportFix{&fix})
+		}
+		list.Items = append(list.Items, item)
+	}
+	return list, nil
+}
+
+// importEdits returns the edits changing the imports of src to those of
+// res, the result of applying fixes to it. If a fix renames references to
+// a package, as the alias policy may require, the edits change the whole
+// file, as the file wouldn't compile with its imports alone changed.
+func importEdits(src, res []byte, fixes []*imports.ImportFix) []TextEdit {
+	for _, fix := range fixes {
+		if fix.RenamesReferences() {
+			return textEdits(src, res)
+		}
+	}
+	return textEdits(src, spliceImports(src, res))
+}
+
+// spliceImports returns src with its package clause and imports replaced by
+// those of res, so that changes to the rest of the file are left out.
+// It returns res if either can't be parsed.
+func spliceImports(src, res []byte) []byte {
+	srcEnd, ok1 := importsEnd(src)
+	resEnd, ok2 := importsEnd(res)
+	if !ok1 || !ok2 {
+		return res
+	}
+	return append(append([]byte(nil), res[:resEnd]...), src[srcEnd:]...)
+}
+
+// importsEnd returns the offset of the end of the imports in src, or of the
+// package clause if there are none.
+func importsEnd(src []byte) (int, bool) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ImportsOnly|parser.ParseComments)
+	if err != nil {
+		return 0, false
+	}
+	end := f.Name.End()
+	for _, d := range f.Decls {
+		end = d.End()
+	}
+	return fset.Position(end).Offset, true
+}
+
+// textEdits returns the edits turning old into new, as whole lines.
+func textEdits(old, new []byte) []TextEdit {
+	oldLines, newLines := diff.SplitLines(old), diff.SplitLines(new)
+	pos := func(line int) Position {
+		if line == len(oldLines) && line > 0 && !strings.HasSuffix(string(oldLines[line-1]), "\n") {
+			// The end of a last line without a newline.
+			return Position{Line: line - 1, Character: utf16Len(oldLines[line-1])}
+		}
+		return Position{Line: line}
+	}
+	edits := []TextEdit{}
+	for _, e := range diff.Edits(old, new) {
+		var text strings.Builder
+		for _, l := range newLines[e.NewStart:e.NewEnd] {
+			text.Write(l)
+		}
+		edits = append(edits, TextEdit{
+			Range:   Range{Start: pos(e.OldStart), End: pos(e.OldEnd)},
+			NewText: text.String(),
+		})
+	}
+	return edits
+}
+
+// offset returns the byte offset of pos in src, clamped to the end of its
+// line.
+func offset(src []byte, pos Position) int {
+	off := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(string(src[off:]), '\n')
+		if i < 0 {
+			return len(src)
+		}
+		off += i + 1
+	}
+	for units := 0; units < pos.Character && off < len(src) && src[off] != '\n'; {
+		r, size := utf8.DecodeRune(src[off:])
+		units += utf16.RuneLen(r)
+		off += size
+	}
+	return off
+}
+
+// utf16Len returns the length of b in UTF-16 code units.
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if l := utf16.RuneLen(r); l > 0 {
+			n += l
+		} else {
+			n++ // an invalid rune, replaced by U+FFFD
+		}
+		b = b[size:]
+	}
+	return n
+}
+
+// uriToPath returns the path of the file:// URI uri.
+func uriToPath(uri DocumentURI) (string, error) {
+	u, err := url.Parse(string(uri))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("%s: only file URIs are supported", uri)
+	}
+	path := u.Path
+	// Windows paths look like /C:/dir/file.
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
@@ -0,0 +1,326 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rinchsan/gosimports/internal/gocommand"
+	"github.com/rinchsan/gosimports/internal/imports"
+)
+
+// session runs a server on the requests and notifications in msgs,
+// followed by shutdown and exit, and returns the responses by id.
+func session(t *testing.T, dir string, msgs ...interface{}) map[int]*message {
+	t.Helper()
+	return sessionWith(t, dir, nil, msgs...)
+}
+
+// sessionWith is like session, with configure, if non-nil, changing the
+// options of the server.
+func sessionWith(t *testing.T, dir string, configure func(*imports.Options), msgs ...interface{}) map[int]*message {
+	t.Helper()
+	var in bytes.Buffer
+	id := 0
+	send := func(method string, params interface{}, request bool) {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msg := &message{JSONRPC: "2.0", Method: method, Params: raw}
+		if request {
+			id++
+			rawID := json.RawMessage(mustMarshal(t, id))
+			msg.ID = &rawID
+		}
+		if err := writeMessage(&in, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	send("initialize", &InitializeParams{RootURI: pathToURI(dir)}, true)
+	send("initialized", struct{}{}, false)
+	for i := 0; i < len(msgs); i += 2 {
+		method := msgs[i].(string)
+		send(method, msgs[i+1], !strings.Contains(method, "/did"))
+	}
+	send("shutdown", nil, true)
+	send("exit", nil, false)
+
+	env := &imports.ProcessEnv{GocmdRunner: &gocommand.Runner{}}
+	s := &Server{
+		Options: func(string) (*imports.Options, error) {
+			opt := &imports.Options{Env: env, Comments: true, TabIndent: true, TabWidth: 8}
+			if configure != nil {
+				configure(opt)
+			}
+			return opt, nil
+		},
+		Env: env,
+	}
+	var out bytes.Buffer
+	if err := s.Serve(&in, &out); err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if env.WorkingDir != dir {
+		t.Errorf("WorkingDir = %q, want %q", env.WorkingDir, dir)
+	}
+
+	resps := map[int]*message{}
+	r := bufio.NewReader(&out)
+	for {
+		data, err := readMessage(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		var id int
+		if err := json.Unmarshal(*msg.ID, &id); err != nil {
+			t.Fatal(err)
+		}
+		resps[id] = &msg
+	}
+	if len(resps) != id {
+		t.Fatalf("got %d responses, want %d", len(resps), id)
+	}
+	return resps
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func pathToURI(path string) DocumentURI {
+	return DocumentURI("file://" + filepath.ToSlash(path))
+}
+
+func result(t *testing.T, msg *message, v interface{}) {
+	t.Helper()
+	if msg.Error != nil {
+		t.Fatalf("request failed: %v", msg.Error)
+	}
+	if err := json.Unmarshal(msg.Result, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// applyEdits applies edits, which must be sorted and not overlap, to src.
+func applyEdits(t *testing.T, src string, edits []TextEdit) string {
+	t.Helper()
+	var b strings.Builder
+	last := 0
+	for _, e := range edits {
+		start, end := offset([]byte(src), e.Range.Start), offset([]byte(src), e.Range.End)
+		if start < last || end < start {
+			t.Fatalf("bad edit %+v", e)
+		}
+		b.WriteString(src[last:start])
+		b.WriteString(e.NewText)
+		last = end
+	}
+	b.WriteString(src[last:])
+	return b.String()
+}
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// The file on disk differs from the open buffer, which must win.
+	filename := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(filename, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	uri := pathToURI(filename)
+	doc := TextDocumentIdentifier{URI: uri}
+
+	const opened = "package main\n\nfunc main() {\n\tfmt.Println( \"x\" )\n}\n"
+	const changed = "package main\n\nimport \"os\"\n\nfunc main() {\n\tfmt.Println( \"x\" )\n\tstrco\n}"
+	resps := session(t, dir,
+		"textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "go", Text: opened}},
+		"textDocument/formatting", &DocumentFormattingParams{TextDocument: doc},
+		"textDocument/codeAction", &CodeActionParams{TextDocument: doc},
+		"textDocument/codeAction", &CodeActionParams{TextDocument: doc, Context: CodeActionContext{Only: []CodeActionKind{"quickfix"}}},
+		"textDocument/didChange", &DidChangeTextDocumentParams{ContentChanges: []TextDocumentContentChangeEvent{{Text: changed}}, TextDocument: VersionedTextDocumentIdentifier{URI: uri}},
+		"textDocument/completion", &CompletionParams{TextDocument: doc, Position: Position{Line: 6, Character: 6}},
+		"textDocument/hover", &CompletionParams{TextDocument: doc},
+	)
+
+	var init InitializeResult
+	result(t, resps[1], &init)
+	if !init.Capabilities.DocumentFormattingProvider || init.Capabilities.TextDocumentSync.Change != TextDocumentSyncFull {
+		t.Errorf("unexpected capabilities %+v", init.Capabilities)
+	}
+
+	var edits []TextEdit
+	result(t, resps[2], &edits)
+	want := "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"x\")\n}\n"
+	if got := applyEdits(t, opened, edits); got != want {
+		t.Errorf("formatting:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	var actions []CodeAction
+	result(t, resps[3], &actions)
+	if len(actions) != 1 || actions[0].Kind != SourceOrganizeImports {
+		t.Fatalf("got code actions %+v, want one organizing imports", actions)
+	}
+	// Organizing imports leaves the rest of the file alone.
+	want = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println( \"x\" )\n}\n"
+	if got := applyEdits(t, opened, actions[0].Edit.Changes[uri]); got != want {
+		t.Errorf("organize imports:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	result(t, resps[4], &actions)
+	if len(actions) != 0 {
+		t.Errorf("got code actions %+v for quickfix, want none", actions)
+	}
+
+	var list CompletionList
+	result(t, resps[5], &list)
+	var item *CompletionItem
+	for i := range list.Items {
+		if list.Items[i].Detail == `"strconv"` {
+			item = &list.Items[i]
+		}
+		if list.Items[i].Detail == `"os"` {
+			t.Errorf("completion offered the imported package os")
+		}
+	}
+	if item == nil {
+		t.Fatalf("completion items %+v don't include strconv", list.Items)
+	}
+	if item.Label != "strconv" || item.Kind != CompletionItemModule {
+		t.Errorf("unexpected item %+v", item)
+	}
+	want = "package main\n\nimport (\n\t\"os\"\n\t\"strconv\"\n)\n\nfunc main() {\n\tfmt.Println( \"x\" )\n\tstrco\n}"
+	if got := applyEdits(t, changed, item.AdditionalTextEdits); got != want {
+		t.Errorf("completion edits:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if resps[6].Error == nil || resps[6].Error.Code != codeMethodNotFound {
+		t.Errorf("hover: got %+v, want method not found", resps[6])
+	}
+}
+
+func TestCodeActionAliases(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	uri := pathToURI(filepath.Join(dir, "main.go"))
+	const opened = "package main\n\nimport \"os\"\n\nfunc main() {\n\tfmt.Println( \"x\" )\n\tos.Exit(0)\n}\n"
+	resps := sessionWith(t, dir, func(opt *imports.Options) {
+		opt.Aliases = map[string]string{"fmt": "format", "os": "goos"}
+	},
+		"textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "go", Text: opened}},
+		"textDocument/codeAction", &CodeActionParams{TextDocument: TextDocumentIdentifier{URI: uri}},
+	)
+
+	var actions []CodeAction
+	result(t, resps[2], &actions)
+	if len(actions) != 1 {
+		t.Fatalf("got code actions %+v, want one organizing imports", actions)
+	}
+	// The references are renamed along with the imports, so the whole file
+	// is formatted.
+	want := "package main\n\nimport (\n\tformat \"fmt\"\n\tgoos \"os\"\n)\n\nfunc main() {\n\tformat.Println(\"x\")\n\tgoos.Exit(0)\n}\n"
+	if got := applyEdits(t, opened, actions[0].Edit.Changes[uri]); got != want {
+		t.Errorf("organize imports:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestTextEdits(t *testing.T) {
+	for _, test := range []struct{ old, new string }{
+		{"a\nb\nc\n", "a\nx\nc\n"},
+		{"a\nb", "a\nb\n"},
+		{"a\nbé", "a\nc"},
+		{"", "a\n"},
+		{"a\n", ""},
+	} {
+		if got := applyEdits(t, test.old, textEdits([]byte(test.old), []byte(test.new))); got != test.new {
+			t.Errorf("textEdits(%q, %q) produce %q", test.old, test.new, got)
+		}
+	}
+}
+
+func TestNotInitialized(t *testing.T) {
+	uri := pathToURI(filepath.Join(t.TempDir(), "main.go"))
+	var in bytes.Buffer
+	for i, msg := range []struct {
+		method string
+		params interface{}
+		id     int // 0 for notifications
+	}{
+		{"textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, Text: "package main\n"}}, 0},
+		{"textDocument/formatting", &DocumentFormattingParams{TextDocument: TextDocumentIdentifier{URI: uri}}, 1},
+		{"shutdown", nil, 2},
+		{"exit", nil, 0},
+	} {
+		m := &message{JSONRPC: "2.0", Method: msg.method, Params: mustMarshal(t, msg.params)}
+		if msg.id != 0 {
+			id := json.RawMessage(mustMarshal(t, msg.id))
+			m.ID = &id
+		}
+		if err := writeMessage(&in, m); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+	var out bytes.Buffer
+	s := &Server{Options: func(string) (*imports.Options, error) { return &imports.Options{}, nil }}
+	if err := s.Serve(&in, &out); err == nil {
+		t.Error("Serve succeeded, want an error for exiting without shutting down")
+	}
+	data, err := readMessage(bufio.NewReader(&out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp message
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == nil || resp.Error.Code != codeServerNotInitialized {
+		t.Errorf("formatting before initialize: got %s, want server not initialized", data)
+	}
+}
+
+func TestOpenDocumentsOverlay(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/m\n\ngo 1.20\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// other.go is only open, not saved: its import tells how the package
+	// refers to strings.
+	other := pathToURI(filepath.Join(dir, "other.go"))
+	uri := pathToURI(filepath.Join(dir, "main.go"))
+	const opened = "package main\n\nfunc main() {\n\tstr.TrimSpace(\"x\")\n}\n"
+	resps := session(t, dir,
+		"textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: other, LanguageID: "go", Text: "package main\n\nimport str \"strings\"\n\nvar _ = str.Split\n"}},
+		"textDocument/didOpen", &DidOpenTextDocumentParams{TextDocument: TextDocumentItem{URI: uri, LanguageID: "go", Text: opened}},
+		"textDocument/codeAction", &CodeActionParams{TextDocument: TextDocumentIdentifier{URI: uri}},
+	)
+
+	var actions []CodeAction
+	result(t, resps[2], &actions)
+	if len(actions) != 1 {
+		t.Fatalf("got code actions %+v, want one organizing imports", actions)
+	}
+	want := "package main\n\nimport str \"strings\"\n\nfunc main() {\n\tstr.TrimSpace(\"x\")\n}\n"
+	if got := applyEdits(t, opened, actions[0].Edit.Changes[uri]); got != want {
+		t.Errorf("organize imports:\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}